@@ -0,0 +1,69 @@
+package schoolsout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// decodeJSONBody decodes a single JSON value from a POST body into dst.
+// It enforces the application/json content type and request.maxBodyBytes,
+// rejects trailing data after the value and, with request.strictJson, unknown
+// fields. On failure it returns the HTTP status to respond with.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst any) (int, error) {
+	defer r.Body.Close()
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return http.StatusUnsupportedMediaType, fmt.Errorf("Content-Type must be application/json")
+	}
+
+	maxBytes := int64(appConfig.Request.MaxBodyBytes)
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes))
+	if appConfig.Request.StrictJSON {
+		decoder.DisallowUnknownFields()
+	}
+
+	if err := decoder.Decode(dst); err != nil {
+		return jsonDecodeError(err, maxBytes)
+	}
+
+	// The body must hold exactly one JSON value
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return http.StatusRequestEntityTooLarge, fmt.Errorf("Request body must not be larger than %d bytes", maxBytes)
+		}
+		return http.StatusBadRequest, fmt.Errorf("Request body must contain a single JSON object")
+	}
+
+	return http.StatusOK, nil
+}
+
+// jsonDecodeError turns a decoding error into a status and a message safe to return to clients
+func jsonDecodeError(err error, maxBytes int64) (int, error) {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge, fmt.Errorf("Request body must not be larger than %d bytes", maxBytes)
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return http.StatusBadRequest, fmt.Errorf("Invalid JSON format")
+	case errors.As(err, &typeErr):
+		return http.StatusBadRequest, fmt.Errorf("Invalid value for field %q", typeErr.Field)
+	case errors.Is(err, io.EOF):
+		return http.StatusBadRequest, fmt.Errorf("Request body must not be empty")
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for DisallowUnknownFields
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		return http.StatusBadRequest, fmt.Errorf("Unknown field %s", field)
+	default:
+		return http.StatusBadRequest, fmt.Errorf("Invalid JSON format")
+	}
+}
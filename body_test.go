@@ -0,0 +1,64 @@
+package schoolsout
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSONBody(t *testing.T) {
+	request := appConfig.Request
+	t.Cleanup(func() { appConfig.Request = request })
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		maxBytes    int
+		strict      bool
+		status      int
+		message     string
+	}{
+		{name: "valid", contentType: "application/json", body: `{"query":"museums"}`, status: http.StatusOK},
+		{name: "content type with charset", contentType: "application/json; charset=utf-8", body: `{"query":"museums"}`, status: http.StatusOK},
+		{name: "missing content type", body: `{"query":"museums"}`, status: http.StatusUnsupportedMediaType, message: "Content-Type must be application/json"},
+		{name: "wrong content type", contentType: "text/plain", body: `{"query":"museums"}`, status: http.StatusUnsupportedMediaType, message: "Content-Type must be application/json"},
+		{name: "too large", contentType: "application/json", body: `{"query":"` + strings.Repeat("a", 64) + `"}`, maxBytes: 32, status: http.StatusRequestEntityTooLarge, message: "Request body must not be larger than 32 bytes"},
+		{name: "too large after the object", contentType: "application/json", body: `{"query":"a"}` + strings.Repeat(" ", 64), maxBytes: 32, status: http.StatusRequestEntityTooLarge, message: "Request body must not be larger than 32 bytes"},
+		{name: "unknown field allowed", contentType: "application/json", body: `{"query":"museums","colour":"red"}`, status: http.StatusOK},
+		{name: "unknown field when strict", contentType: "application/json", body: `{"query":"museums","colour":"red"}`, strict: true, status: http.StatusBadRequest, message: `Unknown field "colour"`},
+		{name: "trailing object", contentType: "application/json", body: `{"query":"museums"}{"query":"parks"}`, status: http.StatusBadRequest, message: "Request body must contain a single JSON object"},
+		{name: "trailing garbage", contentType: "application/json", body: `{"query":"museums"} x`, status: http.StatusBadRequest, message: "Request body must contain a single JSON object"},
+		{name: "trailing whitespace", contentType: "application/json", body: "{\"query\":\"museums\"}\n", status: http.StatusOK},
+		{name: "malformed", contentType: "application/json", body: `{"query":`, status: http.StatusBadRequest, message: "Invalid JSON format"},
+		{name: "syntax error", contentType: "application/json", body: `{query: "museums"}`, status: http.StatusBadRequest, message: "Invalid JSON format"},
+		{name: "wrong type", contentType: "application/json", body: `{"query":42}`, status: http.StatusBadRequest, message: `Invalid value for field "query"`},
+		{name: "empty", contentType: "application/json", body: "", status: http.StatusBadRequest, message: "Request body must not be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appConfig.Request = request
+			appConfig.Request.StrictJSON = tt.strict
+			if tt.maxBytes > 0 {
+				appConfig.Request.MaxBodyBytes = tt.maxBytes
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/search", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			var dst SearchRequest
+			status, err := decodeJSONBody(httptest.NewRecorder(), r, &dst)
+			if status != tt.status {
+				t.Errorf("status = %d, want %d (error %v)", status, tt.status, err)
+			}
+			switch {
+			case tt.message == "" && err != nil:
+				t.Errorf("error = %v, want none", err)
+			case tt.message != "" && (err == nil || err.Error() != tt.message):
+				t.Errorf("error = %v, want %q", err, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package schoolsout
+
+import (
+	"fmt"
+	"strings"
+)
+
+// categoryOther is assigned to activities that fit no category in the taxonomy
+const categoryOther = "Other"
+
+// categoryDefinition is one category of the taxonomy with the free-text names
+// Gemini uses for it
+type categoryDefinition struct {
+	Name     string
+	Synonyms []string // Matched as whole words, case-insensitively
+}
+
+// categoryTaxonomy is the controlled list of categories activities are mapped into
+var categoryTaxonomy = []categoryDefinition{
+	{Name: "Educational", Synonyms: []string{"education", "educational", "learning", "workshop", "library", "history", "museum", "reading"}},
+	{Name: "Sports", Synonyms: []string{"sport", "sports", "swimming", "football", "soccer", "cricket", "tennis", "basketball", "gymnastics", "fitness", "climbing", "skating"}},
+	{Name: "Arts", Synonyms: []string{"art", "arts", "craft", "crafts", "music", "dance", "drama", "theatre", "theater", "painting", "creative"}},
+	{Name: "Outdoor", Synonyms: []string{"outdoor", "outdoors", "nature", "park", "parks", "camping", "hiking", "beach", "adventure", "wildlife", "zoo", "farm"}},
+	{Name: "Entertainment", Synonyms: []string{"entertainment", "movie", "movies", "cinema", "show", "shows", "festival", "games", "play", "fun"}},
+	{Name: "Technology", Synonyms: []string{"technology", "tech", "coding", "programming", "robotics", "gaming", "digital", "computer"}},
+	{Name: "Science", Synonyms: []string{"science", "stem", "space", "astronomy", "experiment", "experiments", "chemistry", "physics"}},
+}
+
+// activityCategories are the categories Stage 2 is asked to assign to activities
+var activityCategories = func() []string {
+	names := make([]string, 0, len(categoryTaxonomy)+1)
+	for _, category := range categoryTaxonomy {
+		names = append(names, category.Name)
+	}
+	return append(names, categoryOther)
+}()
+
+// normalizeCategory maps a free-text category ("outdoors", "Nature & Outdoors")
+// onto the taxonomy, or categoryOther when nothing matches
+func normalizeCategory(text string) string {
+	words := locationWords(text)
+	for _, category := range categoryTaxonomy {
+		if strings.EqualFold(strings.TrimSpace(text), category.Name) {
+			return category.Name
+		}
+	}
+	// The first word that names a category wins, so "STEM workshop" is Science
+	for _, word := range words {
+		for _, category := range categoryTaxonomy {
+			for _, synonym := range category.Synonyms {
+				if word == synonym {
+					return category.Name
+				}
+			}
+		}
+	}
+	return categoryOther
+}
+
+// canonicalCategory returns the taxonomy name of a category requested by a client
+func canonicalCategory(name string) (string, error) {
+	for _, category := range activityCategories {
+		if strings.EqualFold(strings.TrimSpace(name), category) {
+			return category, nil
+		}
+	}
+	return "", fmt.Errorf("unknown category %q; see /v1/categories", name)
+}
+
+// normalizeCategories maps the category of every activity onto the taxonomy
+func normalizeCategories(activities []Activity) {
+	for i := range activities {
+		activities[i].Category = normalizeCategory(activities[i].Category)
+	}
+}
@@ -0,0 +1,768 @@
+package schoolsout
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables used to configure the function
+const (
+	envConfigFile               = "SCHOOLSOUT_CONFIG_FILE"
+	envGeminiModel              = "SCHOOLSOUT_GEMINI_MODEL"
+	envGeminiBaseURL            = "SCHOOLSOUT_GEMINI_BASE_URL"
+	envGeminiAPIKeySecret       = "SCHOOLSOUT_GEMINI_API_KEY_SECRET"
+	envGeminiAPIKeyVersion      = "SCHOOLSOUT_GEMINI_API_KEY_SECRET_VERSION"
+	envGeminiAPIKeyFile         = "SCHOOLSOUT_GEMINI_API_KEY_FILE"
+	envGeminiAPIKeyCacheTTL     = "SCHOOLSOUT_GEMINI_API_KEY_CACHE_TTL"
+	envGeminiInputPrice         = "SCHOOLSOUT_GEMINI_INPUT_PRICE_PER_MILLION"
+	envGeminiOutputPrice        = "SCHOOLSOUT_GEMINI_OUTPUT_PRICE_PER_MILLION"
+	envRateLimitMaxRequests     = "SCHOOLSOUT_RATE_LIMIT_MAX_REQUESTS"
+	envRateLimitWindow          = "SCHOOLSOUT_RATE_LIMIT_WINDOW"
+	envRateLimitCleanupInterval = "SCHOOLSOUT_RATE_LIMIT_CLEANUP_INTERVAL"
+	envSearchMinResults         = "SCHOOLSOUT_SEARCH_MIN_RESULTS"
+	envSearchMaxResults         = "SCHOOLSOUT_SEARCH_MAX_RESULTS"
+	envSearchURLRecoveryLimit   = "SCHOOLSOUT_SEARCH_URL_RECOVERY_LIMIT"
+	envSearchCacheMaxAge        = "SCHOOLSOUT_SEARCH_CACHE_MAX_AGE"
+	envSearchMaxPageSize        = "SCHOOLSOUT_SEARCH_MAX_PAGE_SIZE"
+	envSearchSessionTTL         = "SCHOOLSOUT_SEARCH_SESSION_TTL"
+	envSearchMaxRefinements     = "SCHOOLSOUT_SEARCH_MAX_REFINEMENTS"
+	envSearchPublicBaseURL      = "SCHOOLSOUT_SEARCH_PUBLIC_BASE_URL"
+	envRequestMaxBodyBytes      = "SCHOOLSOUT_REQUEST_MAX_BODY_BYTES"
+	envRequestStrictJSON        = "SCHOOLSOUT_REQUEST_STRICT_JSON"
+	envStoreBackend             = "SCHOOLSOUT_STORE_BACKEND"
+	envStorePath                = "SCHOOLSOUT_STORE_PATH"
+	envStoreMaxActivities       = "SCHOOLSOUT_STORE_MAX_ACTIVITIES"
+	envAlertsBackend            = "SCHOOLSOUT_ALERTS_BACKEND"
+	envAlertsPath               = "SCHOOLSOUT_ALERTS_PATH"
+	envAlertsNotifier           = "SCHOOLSOUT_ALERTS_NOTIFIER"
+	envAlertsNotifierPath       = "SCHOOLSOUT_ALERTS_NOTIFIER_PATH"
+	envAlertsMaxSearchesPerRun  = "SCHOOLSOUT_ALERTS_MAX_SEARCHES_PER_RUN"
+	envAlertsRunKey             = "SCHOOLSOUT_ALERTS_RUN_KEY"
+	envHolidaysDir              = "SCHOOLSOUT_HOLIDAYS_DIR"
+	envGeoGazetteerFile         = "SCHOOLSOUT_GEO_GAZETTEER_FILE"
+	envGeoMaxRadiusKm           = "SCHOOLSOUT_GEO_MAX_RADIUS_KM"
+	envWeatherProvider          = "SCHOOLSOUT_WEATHER_PROVIDER"
+	envWeatherBaseURL           = "SCHOOLSOUT_WEATHER_BASE_URL"
+	envWeatherFixtureFile       = "SCHOOLSOUT_WEATHER_FIXTURE_FILE"
+	envWeatherTimeout           = "SCHOOLSOUT_WEATHER_TIMEOUT"
+	envWeatherHotTempC          = "SCHOOLSOUT_WEATHER_HOT_TEMP_C"
+	envWeatherRainChance        = "SCHOOLSOUT_WEATHER_RAIN_CHANCE"
+	envWeatherRainMm            = "SCHOOLSOUT_WEATHER_RAIN_MM"
+	envBudgetMaxTokensPerReq    = "SCHOOLSOUT_BUDGET_MAX_TOKENS_PER_REQUEST"
+	envBudgetMaxTokensPerDay    = "SCHOOLSOUT_BUDGET_MAX_TOKENS_PER_DAY"
+	envBudgetAction             = "SCHOOLSOUT_BUDGET_ACTION"
+	envDebugEndpoints           = "SCHOOLSOUT_DEBUG_ENDPOINTS"
+	envAuthAPIKeys              = "SCHOOLSOUT_AUTH_API_KEYS"
+	envAuthUserKeys             = "SCHOOLSOUT_AUTH_USER_KEYS"
+	envHealthTimeout            = "SCHOOLSOUT_HEALTH_TIMEOUT"
+	envHealthCacheTTL           = "SCHOOLSOUT_HEALTH_CACHE_TTL"
+	envMetricsExporter          = "SCHOOLSOUT_METRICS_EXPORTER"
+	envMetricsExportInterval    = "SCHOOLSOUT_METRICS_EXPORT_INTERVAL"
+	envTracingExporter          = "SCHOOLSOUT_TRACING_EXPORTER"
+	envTracingSampleRatio       = "SCHOOLSOUT_TRACING_SAMPLE_RATIO"
+	envLogLevel                 = "SCHOOLSOUT_LOG_LEVEL"
+	envLogRedact                = "SCHOOLSOUT_LOG_REDACT"
+)
+
+// Duration is a time.Duration that reads and writes as a string (e.g. "1m", "10m")
+// in both JSON and YAML config files
+type Duration time.Duration
+
+// MarshalText implements encoding.TextMarshaler
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// GeminiConfig holds settings for the Gemini API client
+type GeminiConfig struct {
+	Model               string   `json:"model" yaml:"model"`
+	BaseURL             string   `json:"baseUrl" yaml:"baseUrl"`
+	APIKeySecret        string   `json:"apiKeySecret" yaml:"apiKeySecret"`               // Secret Manager secret name
+	APIKeySecretVersion string   `json:"apiKeySecretVersion" yaml:"apiKeySecretVersion"` // Secret Manager secret version
+	APIKeyFile          string   `json:"apiKeyFile" yaml:"apiKeyFile"`                   // Path to a mounted file holding the key
+	APIKeyCacheTTL      Duration `json:"apiKeyCacheTtl" yaml:"apiKeyCacheTtl"`           // How long a resolved key is used before it is resolved again
+
+	// Prices in USD per million tokens, used to estimate the cost of each search
+	InputPricePerMillion  float64 `json:"inputPricePerMillion" yaml:"inputPricePerMillion"`
+	OutputPricePerMillion float64 `json:"outputPricePerMillion" yaml:"outputPricePerMillion"`
+}
+
+// BudgetConfig holds Gemini token budgets. A zero limit means unlimited.
+type BudgetConfig struct {
+	MaxTokensPerRequest int    `json:"maxTokensPerRequest" yaml:"maxTokensPerRequest"`
+	MaxTokensPerDay     int    `json:"maxTokensPerDay" yaml:"maxTokensPerDay"` // Per instance, reset at midnight UTC
+	Action              string `json:"action" yaml:"action"`                   // abort or degrade
+}
+
+// RateLimitConfig holds settings for the per-IP rate limiter
+type RateLimitConfig struct {
+	MaxRequests     int      `json:"maxRequests" yaml:"maxRequests"` // Max requests per IP per window
+	Window          Duration `json:"window" yaml:"window"`
+	CleanupInterval Duration `json:"cleanupInterval" yaml:"cleanupInterval"`
+}
+
+// SearchConfig holds settings for the activity search pipeline
+type SearchConfig struct {
+	MinResults       int      `json:"minResults" yaml:"minResults"`             // Lower bound of activities requested from Stage 1
+	MaxResults       int      `json:"maxResults" yaml:"maxResults"`             // Upper bound of activities requested from Stage 1
+	URLRecoveryLimit int      `json:"urlRecoveryLimit" yaml:"urlRecoveryLimit"` // Max Stage 3 recovery requests per search
+	CacheMaxAge      Duration `json:"cacheMaxAge" yaml:"cacheMaxAge"`           // Cache-Control max-age for GET search responses
+	MaxPageSize      int      `json:"maxPageSize" yaml:"maxPageSize"`           // Largest pageSize a client may request
+	SessionTTL       Duration `json:"sessionTtl" yaml:"sessionTtl"`             // How long a paginated or refinable search is remembered
+	MaxRefinements   int      `json:"maxRefinements" yaml:"maxRefinements"`     // Follow-ups allowed per search; 0 disables refinement
+	PublicBaseURL    string   `json:"publicBaseUrl" yaml:"publicBaseUrl"`       // Public URL of the API that share URLs start with; unset omits them
+}
+
+// RequestConfig holds limits applied to incoming request bodies
+type RequestConfig struct {
+	MaxBodyBytes int  `json:"maxBodyBytes" yaml:"maxBodyBytes"` // Largest accepted POST body
+	StrictJSON   bool `json:"strictJson" yaml:"strictJson"`     // Reject bodies with fields SearchRequest doesn't know
+}
+
+// StoreConfig holds settings for the activity store behind GET /v1/activities/{id}
+type StoreConfig struct {
+	Backend       string `json:"backend" yaml:"backend"`             // memory, or file for local runs and single instances
+	Path          string `json:"path" yaml:"path"`                   // JSON file used by the file backend
+	MaxActivities int    `json:"maxActivities" yaml:"maxActivities"` // Oldest activities are evicted beyond this; 0 keeps all
+}
+
+// AlertsConfig holds settings for saved searches and new-activity alerts
+type AlertsConfig struct {
+	Backend           string `json:"backend" yaml:"backend"`                     // Saved search store: memory or file
+	Path              string `json:"path" yaml:"path"`                           // JSON file used by the file backend
+	Notifier          string `json:"notifier" yaml:"notifier"`                   // log or file
+	NotifierPath      string `json:"notifierPath" yaml:"notifierPath"`           // JSON lines file used by the file notifier
+	MaxSearchesPerRun int    `json:"maxSearchesPerRun" yaml:"maxSearchesPerRun"` // Saved searches re-run by one RunSavedSearches call
+	RunKey            string `json:"runKey" yaml:"runKey"`                       // Key the scheduler sends to RunSavedSearches; runs are refused without one
+}
+
+// HolidaysConfig holds settings for the school holiday calendars
+type HolidaysConfig struct {
+	Dir string `json:"dir" yaml:"dir"` // Extra calendar files; they replace bundled regions with the same code
+}
+
+// GeoConfig holds settings for geocoding and radius searches
+type GeoConfig struct {
+	GazetteerFile string  `json:"gazetteerFile" yaml:"gazetteerFile"` // Extra places (name,state,postcode,latitude,longitude CSV)
+	MaxRadiusKm   float64 `json:"maxRadiusKm" yaml:"maxRadiusKm"`     // Largest radiusKm a client may request
+}
+
+// WeatherConfig holds settings for the forecast used to rank and annotate activities
+type WeatherConfig struct {
+	Provider    string   `json:"provider" yaml:"provider"`       // none, openmeteo or fixture
+	BaseURL     string   `json:"baseUrl" yaml:"baseUrl"`         // Open-Meteo API endpoint
+	FixtureFile string   `json:"fixtureFile" yaml:"fixtureFile"` // JSON forecast used by the fixture provider
+	Timeout     Duration `json:"timeout" yaml:"timeout"`         // Deadline for one forecast request
+	HotTempC    float64  `json:"hotTempC" yaml:"hotTempC"`       // Maximum temperature from which a day counts as too hot
+	RainChance  int      `json:"rainChance" yaml:"rainChance"`   // Chance of rain, in percent, from which a day counts as wet
+	RainMm      float64  `json:"rainMm" yaml:"rainMm"`           // Forecast rainfall from which a day counts as wet
+}
+
+// MetricsConfig holds settings for OpenTelemetry metrics
+type MetricsConfig struct {
+	Exporter       string   `json:"exporter" yaml:"exporter"`             // none, stdout, otlp or prometheus
+	ExportInterval Duration `json:"exportInterval" yaml:"exportInterval"` // Push interval for the stdout and otlp exporters
+}
+
+// TracingConfig holds settings for OpenTelemetry tracing
+type TracingConfig struct {
+	Exporter    string  `json:"exporter" yaml:"exporter"`       // none, stdout or otlp
+	SampleRatio float64 `json:"sampleRatio" yaml:"sampleRatio"` // Fraction of new traces sampled; incoming sampled traces are always kept
+}
+
+// AuthConfig holds settings for client authentication
+type AuthConfig struct {
+	APIKeys  []string          `json:"apiKeys" yaml:"apiKeys"`   // Accepted client keys; without any the API is public
+	UserKeys map[string]string `json:"userKeys" yaml:"userKeys"` // Keys that act for one user, by user ID; saved searches need one
+}
+
+// HealthConfig holds settings for the readiness checks
+type HealthConfig struct {
+	Timeout  Duration `json:"timeout" yaml:"timeout"`   // Deadline for all /readyz checks
+	CacheTTL Duration `json:"cacheTtl" yaml:"cacheTtl"` // How long an external API check result is reused
+}
+
+// DebugConfig holds settings for debugging aids
+type DebugConfig struct {
+	Endpoints bool `json:"endpoints" yaml:"endpoints"` // Enables the EffectiveConfig endpoint and debug sections in search responses
+}
+
+// LoggingConfig holds settings for structured logging
+type LoggingConfig struct {
+	Level  string `json:"level" yaml:"level"`   // debug, info, warn or error; prompts and responses are logged at debug
+	Redact bool   `json:"redact" yaml:"redact"` // Scrub API keys, emails, phone numbers and addresses from log output
+}
+
+// Config is the runtime configuration of the function
+type Config struct {
+	Gemini    GeminiConfig    `json:"gemini" yaml:"gemini"`
+	RateLimit RateLimitConfig `json:"rateLimit" yaml:"rateLimit"`
+	Search    SearchConfig    `json:"search" yaml:"search"`
+	Request   RequestConfig   `json:"request" yaml:"request"`
+	Store     StoreConfig     `json:"store" yaml:"store"`
+	Alerts    AlertsConfig    `json:"alerts" yaml:"alerts"`
+	Holidays  HolidaysConfig  `json:"holidays" yaml:"holidays"`
+	Geo       GeoConfig       `json:"geo" yaml:"geo"`
+	Weather   WeatherConfig   `json:"weather" yaml:"weather"`
+	Budget    BudgetConfig    `json:"budget" yaml:"budget"`
+	Logging   LoggingConfig   `json:"logging" yaml:"logging"`
+	Metrics   MetricsConfig   `json:"metrics" yaml:"metrics"`
+	Tracing   TracingConfig   `json:"tracing" yaml:"tracing"`
+	Auth      AuthConfig      `json:"auth" yaml:"auth"`
+	Health    HealthConfig    `json:"health" yaml:"health"`
+	Debug     DebugConfig     `json:"debug" yaml:"debug"`
+}
+
+// appConfig is the effective configuration, loaded once at startup
+var appConfig = mustLoadConfig()
+
+// DefaultConfig returns the configuration used when nothing is overridden
+func DefaultConfig() *Config {
+	return &Config{
+		Gemini: GeminiConfig{
+			Model:               "gemini-2.0-flash",
+			BaseURL:             "https://generativelanguage.googleapis.com/v1beta",
+			APIKeySecret:        "gemini-api-key",
+			APIKeySecretVersion: "latest",
+			APIKeyCacheTTL:      Duration(time.Hour),
+			// gemini-2.0-flash list prices
+			InputPricePerMillion:  0.10,
+			OutputPricePerMillion: 0.40,
+		},
+		RateLimit: RateLimitConfig{
+			MaxRequests:     20,
+			Window:          Duration(time.Minute),
+			CleanupInterval: Duration(10 * time.Minute),
+		},
+		Search: SearchConfig{
+			MinResults:       5,
+			MaxResults:       10,
+			URLRecoveryLimit: 2,
+			CacheMaxAge:      Duration(15 * time.Minute),
+			MaxPageSize:      20,
+			SessionTTL:       Duration(30 * time.Minute),
+			MaxRefinements:   5,
+		},
+		Request: RequestConfig{
+			MaxBodyBytes: 64 << 10,
+		},
+		Store: StoreConfig{
+			Backend:       storeBackendMemory,
+			MaxActivities: 10000,
+		},
+		Alerts: AlertsConfig{
+			Backend:           storeBackendMemory,
+			Notifier:          notifierLog,
+			MaxSearchesPerRun: 50,
+		},
+		Geo: GeoConfig{
+			MaxRadiusKm: 200,
+		},
+		Weather: WeatherConfig{
+			Provider:   weatherProviderNone,
+			BaseURL:    "https://api.open-meteo.com/v1",
+			Timeout:    Duration(5 * time.Second),
+			HotTempC:   35,
+			RainChance: 60,
+			RainMm:     5,
+		},
+		Budget: BudgetConfig{
+			Action: budgetActionDegrade,
+		},
+		Health: HealthConfig{
+			Timeout:  Duration(5 * time.Second),
+			CacheTTL: Duration(30 * time.Second),
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Redact: true,
+		},
+		Metrics: MetricsConfig{
+			Exporter:       metricsExporterNone,
+			ExportInterval: Duration(time.Minute),
+		},
+		Tracing: TracingConfig{
+			Exporter:    tracingExporterNone,
+			SampleRatio: 1,
+		},
+	}
+}
+
+// LoadConfig builds the configuration from defaults, then the optional config file
+// named by SCHOOLSOUT_CONFIG_FILE, then environment variable overrides, and validates it
+func LoadConfig() (*Config, error) {
+	cfg := DefaultConfig()
+
+	if path := os.Getenv(envConfigFile); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// mustLoadConfig loads the configuration and stops the instance if it is invalid
+func mustLoadConfig() *Config {
+	cfg, err := LoadConfig()
+	if err != nil {
+		log.Fatalf("Error: Failed to load configuration: %v", err)
+	}
+	return cfg
+}
+
+// loadFile overlays values from a YAML or JSON file onto the configuration
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".json":
+		err = json.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("unsupported config file extension %q (use .yaml, .yml or .json)", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// applyEnv overlays values from environment variables onto the configuration
+func (c *Config) applyEnv() error {
+	setString(envGeminiModel, &c.Gemini.Model)
+	setString(envGeminiBaseURL, &c.Gemini.BaseURL)
+	setString(envGeminiAPIKeySecret, &c.Gemini.APIKeySecret)
+	setString(envGeminiAPIKeyVersion, &c.Gemini.APIKeySecretVersion)
+	setString(envGeminiAPIKeyFile, &c.Gemini.APIKeyFile)
+	setString(envLogLevel, &c.Logging.Level)
+	setString(envMetricsExporter, &c.Metrics.Exporter)
+	setString(envTracingExporter, &c.Tracing.Exporter)
+	setString(envBudgetAction, &c.Budget.Action)
+	setString(envStoreBackend, &c.Store.Backend)
+	setString(envStorePath, &c.Store.Path)
+	setString(envAlertsBackend, &c.Alerts.Backend)
+	setString(envAlertsPath, &c.Alerts.Path)
+	setString(envAlertsNotifier, &c.Alerts.Notifier)
+	setString(envAlertsNotifierPath, &c.Alerts.NotifierPath)
+	setString(envAlertsRunKey, &c.Alerts.RunKey)
+	setString(envHolidaysDir, &c.Holidays.Dir)
+	setString(envGeoGazetteerFile, &c.Geo.GazetteerFile)
+	setString(envWeatherProvider, &c.Weather.Provider)
+	setString(envWeatherBaseURL, &c.Weather.BaseURL)
+	setString(envWeatherFixtureFile, &c.Weather.FixtureFile)
+	setStringList(envAuthAPIKeys, &c.Auth.APIKeys)
+	if err := setStringMap(envAuthUserKeys, &c.Auth.UserKeys); err != nil {
+		return err
+	}
+
+	if err := setInt(envRateLimitMaxRequests, &c.RateLimit.MaxRequests); err != nil {
+		return err
+	}
+	if err := setDuration(envRateLimitWindow, &c.RateLimit.Window); err != nil {
+		return err
+	}
+	if err := setDuration(envRateLimitCleanupInterval, &c.RateLimit.CleanupInterval); err != nil {
+		return err
+	}
+	if err := setInt(envSearchMinResults, &c.Search.MinResults); err != nil {
+		return err
+	}
+	if err := setInt(envSearchMaxResults, &c.Search.MaxResults); err != nil {
+		return err
+	}
+	if err := setInt(envSearchURLRecoveryLimit, &c.Search.URLRecoveryLimit); err != nil {
+		return err
+	}
+	if err := setDuration(envSearchCacheMaxAge, &c.Search.CacheMaxAge); err != nil {
+		return err
+	}
+	if err := setInt(envSearchMaxPageSize, &c.Search.MaxPageSize); err != nil {
+		return err
+	}
+	if err := setDuration(envSearchSessionTTL, &c.Search.SessionTTL); err != nil {
+		return err
+	}
+	if err := setInt(envSearchMaxRefinements, &c.Search.MaxRefinements); err != nil {
+		return err
+	}
+	setString(envSearchPublicBaseURL, &c.Search.PublicBaseURL)
+	if err := setInt(envRequestMaxBodyBytes, &c.Request.MaxBodyBytes); err != nil {
+		return err
+	}
+	if err := setBool(envRequestStrictJSON, &c.Request.StrictJSON); err != nil {
+		return err
+	}
+	if err := setInt(envStoreMaxActivities, &c.Store.MaxActivities); err != nil {
+		return err
+	}
+	if err := setInt(envAlertsMaxSearchesPerRun, &c.Alerts.MaxSearchesPerRun); err != nil {
+		return err
+	}
+	if err := setBool(envLogRedact, &c.Logging.Redact); err != nil {
+		return err
+	}
+	if err := setDuration(envMetricsExportInterval, &c.Metrics.ExportInterval); err != nil {
+		return err
+	}
+	if err := setFloat(envTracingSampleRatio, &c.Tracing.SampleRatio); err != nil {
+		return err
+	}
+	if err := setFloat(envGeoMaxRadiusKm, &c.Geo.MaxRadiusKm); err != nil {
+		return err
+	}
+	if err := setDuration(envWeatherTimeout, &c.Weather.Timeout); err != nil {
+		return err
+	}
+	if err := setFloat(envWeatherHotTempC, &c.Weather.HotTempC); err != nil {
+		return err
+	}
+	if err := setInt(envWeatherRainChance, &c.Weather.RainChance); err != nil {
+		return err
+	}
+	if err := setFloat(envWeatherRainMm, &c.Weather.RainMm); err != nil {
+		return err
+	}
+	if err := setFloat(envGeminiInputPrice, &c.Gemini.InputPricePerMillion); err != nil {
+		return err
+	}
+	if err := setFloat(envGeminiOutputPrice, &c.Gemini.OutputPricePerMillion); err != nil {
+		return err
+	}
+	if err := setDuration(envGeminiAPIKeyCacheTTL, &c.Gemini.APIKeyCacheTTL); err != nil {
+		return err
+	}
+	if err := setInt(envBudgetMaxTokensPerReq, &c.Budget.MaxTokensPerRequest); err != nil {
+		return err
+	}
+	if err := setInt(envBudgetMaxTokensPerDay, &c.Budget.MaxTokensPerDay); err != nil {
+		return err
+	}
+	if err := setDuration(envHealthTimeout, &c.Health.Timeout); err != nil {
+		return err
+	}
+	if err := setDuration(envHealthCacheTTL, &c.Health.CacheTTL); err != nil {
+		return err
+	}
+	if err := setBool(envDebugEndpoints, &c.Debug.Endpoints); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Validate checks that the configuration values are usable
+func (c *Config) Validate() error {
+	var problems []string
+
+	if strings.TrimSpace(c.Gemini.Model) == "" {
+		problems = append(problems, "gemini.model must not be empty")
+	}
+	if u, err := url.Parse(c.Gemini.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		problems = append(problems, "gemini.baseUrl must be an absolute URL")
+	}
+	if strings.TrimSpace(c.Gemini.APIKeySecret) == "" {
+		problems = append(problems, "gemini.apiKeySecret must not be empty")
+	}
+	if strings.TrimSpace(c.Gemini.APIKeySecretVersion) == "" {
+		problems = append(problems, "gemini.apiKeySecretVersion must not be empty")
+	}
+	if c.Gemini.APIKeyCacheTTL <= 0 {
+		problems = append(problems, "gemini.apiKeyCacheTtl must be positive")
+	}
+	if c.Gemini.InputPricePerMillion < 0 || c.Gemini.OutputPricePerMillion < 0 {
+		problems = append(problems, "gemini token prices must not be negative")
+	}
+	if c.RateLimit.MaxRequests <= 0 {
+		problems = append(problems, "rateLimit.maxRequests must be positive")
+	}
+	if c.RateLimit.Window <= 0 {
+		problems = append(problems, "rateLimit.window must be positive")
+	}
+	if c.RateLimit.CleanupInterval <= 0 {
+		problems = append(problems, "rateLimit.cleanupInterval must be positive")
+	}
+	if c.Search.MinResults <= 0 {
+		problems = append(problems, "search.minResults must be positive")
+	}
+	if c.Search.MaxResults < c.Search.MinResults {
+		problems = append(problems, "search.maxResults must not be less than search.minResults")
+	}
+	if c.Search.URLRecoveryLimit < 0 {
+		problems = append(problems, "search.urlRecoveryLimit must not be negative")
+	}
+	if c.Search.CacheMaxAge < 0 {
+		problems = append(problems, "search.cacheMaxAge must not be negative")
+	}
+	if c.Search.MaxPageSize <= 0 {
+		problems = append(problems, "search.maxPageSize must be positive")
+	}
+	if c.Search.SessionTTL <= 0 {
+		problems = append(problems, "search.sessionTtl must be positive")
+	}
+	if c.Search.MaxRefinements < 0 {
+		problems = append(problems, "search.maxRefinements must not be negative")
+	}
+	if c.Search.PublicBaseURL != "" {
+		if u, err := url.Parse(c.Search.PublicBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, "search.publicBaseUrl must be an absolute http or https URL")
+		}
+	}
+	if c.Request.MaxBodyBytes <= 0 {
+		problems = append(problems, "request.maxBodyBytes must be positive")
+	}
+	if err := validStoreBackend(c.Store.Backend); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if c.Store.Backend == storeBackendFile && strings.TrimSpace(c.Store.Path) == "" {
+		problems = append(problems, "store.path is required for the file backend")
+	}
+	if c.Store.MaxActivities < 0 {
+		problems = append(problems, "store.maxActivities must not be negative")
+	}
+	if c.Alerts.Backend != storeBackendMemory && c.Alerts.Backend != storeBackendFile {
+		problems = append(problems, "alerts.backend must be memory or file")
+	}
+	if c.Alerts.Backend == storeBackendFile && strings.TrimSpace(c.Alerts.Path) == "" {
+		problems = append(problems, "alerts.path is required for the file backend")
+	}
+	if err := validNotifier(c.Alerts.Notifier); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if c.Alerts.Notifier == notifierFile && strings.TrimSpace(c.Alerts.NotifierPath) == "" {
+		problems = append(problems, "alerts.notifierPath is required for the file notifier")
+	}
+	if c.Alerts.MaxSearchesPerRun <= 0 {
+		problems = append(problems, "alerts.maxSearchesPerRun must be positive")
+	}
+	userKeys := make(map[string]bool, len(c.Auth.UserKeys))
+	for userID, key := range c.Auth.UserKeys {
+		if err := validUserID(userID); err != nil {
+			problems = append(problems, "auth.userKeys: "+err.Error())
+		}
+		if strings.TrimSpace(key) == "" || userKeys[key] {
+			problems = append(problems, "auth.userKeys must give every user a different, non-empty key")
+		}
+		userKeys[key] = true
+	}
+	if c.Geo.MaxRadiusKm <= 0 {
+		problems = append(problems, "geo.maxRadiusKm must be positive")
+	}
+	if err := validWeatherProvider(c.Weather.Provider); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if c.Weather.Provider == weatherProviderFixture && strings.TrimSpace(c.Weather.FixtureFile) == "" {
+		problems = append(problems, "weather.fixtureFile is required for the fixture provider")
+	}
+	if c.Weather.Timeout <= 0 {
+		problems = append(problems, "weather.timeout must be positive")
+	}
+	if c.Weather.RainChance < 0 || c.Weather.RainChance > 100 {
+		problems = append(problems, "weather.rainChance must be between 0 and 100")
+	}
+	if c.Weather.RainMm < 0 {
+		problems = append(problems, "weather.rainMm must not be negative")
+	}
+	if c.Health.Timeout <= 0 {
+		problems = append(problems, "health.timeout must be positive")
+	}
+	if c.Health.CacheTTL < 0 {
+		problems = append(problems, "health.cacheTtl must not be negative")
+	}
+	if c.Budget.MaxTokensPerRequest < 0 || c.Budget.MaxTokensPerDay < 0 {
+		problems = append(problems, "budget token limits must not be negative")
+	}
+	if err := validBudgetAction(c.Budget.Action); err != nil {
+		problems = append(problems, err.Error())
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Logging.Level)); err != nil {
+		problems = append(problems, "logging.level must be one of debug, info, warn or error")
+	}
+	if err := validMetricsExporter(c.Metrics.Exporter); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if c.Metrics.ExportInterval <= 0 {
+		problems = append(problems, "metrics.exportInterval must be positive")
+	}
+	if err := validTracingExporter(c.Tracing.Exporter); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		problems = append(problems, "tracing.sampleRatio must be between 0 and 1")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration that is safe to print
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redacted.Auth.APIKeys = make([]string, len(c.Auth.APIKeys))
+	for i := range c.Auth.APIKeys {
+		redacted.Auth.APIKeys[i] = "[REDACTED]"
+	}
+	redacted.Auth.UserKeys = make(map[string]string, len(c.Auth.UserKeys))
+	for userID := range c.Auth.UserKeys {
+		redacted.Auth.UserKeys[userID] = "[REDACTED]"
+	}
+	if c.Alerts.RunKey != "" {
+		redacted.Alerts.RunKey = "[REDACTED]"
+	}
+	return &redacted
+}
+
+// EffectiveConfig is a debug HTTP endpoint that prints the effective (redacted) configuration.
+// It is served at GET /debug/config behind API key authentication, and responds
+// with 404 unless debug endpoints are enabled.
+func EffectiveConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if !appConfig.Debug.Endpoints {
+		sendErrorResponse(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed. Use GET.")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(appConfig.Redacted())
+}
+
+// setString overrides dst with the named environment variable if it is set
+func setString(name string, dst *string) {
+	if value, ok := os.LookupEnv(name); ok {
+		*dst = value
+	}
+}
+
+// setStringList overrides dst with the comma-separated named environment variable if it is set
+func setStringList(name string, dst *[]string) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*dst = list
+}
+
+// setStringMap overrides dst with the named environment variable, a comma-separated
+// list of name=value pairs, if it is set
+func setStringMap(name string, dst *map[string]string) error {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil
+	}
+	pairs := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("invalid %s: entries must be name=value", name)
+		}
+		pairs[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	*dst = pairs
+	return nil
+}
+
+// setInt overrides dst with the named environment variable if it is set
+func setInt(name string, dst *int) error {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil
+	}
+	parsed, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	*dst = parsed
+	return nil
+}
+
+// setFloat overrides dst with the named environment variable if it is set
+func setFloat(name string, dst *float64) error {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil
+	}
+	parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	*dst = parsed
+	return nil
+}
+
+// setBool overrides dst with the named environment variable if it is set
+func setBool(name string, dst *bool) error {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil
+	}
+	parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	*dst = parsed
+	return nil
+}
+
+// setDuration overrides dst with the named environment variable if it is set
+func setDuration(name string, dst *Duration) error {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil
+	}
+	if err := dst.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return nil
+}
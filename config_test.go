@@ -0,0 +1,182 @@
+package schoolsout
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatalf("DefaultConfig().Validate() = %v", err)
+	}
+}
+
+func TestLoadConfigEnvOverrides(t *testing.T) {
+	t.Setenv(envGeminiModel, "gemini-test")
+	t.Setenv(envRateLimitMaxRequests, " 7 ")
+	t.Setenv(envSearchSessionTTL, "5m")
+	t.Setenv(envRequestStrictJSON, "true")
+	t.Setenv(envGeoMaxRadiusKm, "12.5")
+	t.Setenv(envAuthAPIKeys, "one, ,two")
+	t.Setenv(envAuthUserKeys, "alice=key-a, bob = key-b")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Gemini.Model != "gemini-test" {
+		t.Errorf("Gemini.Model = %q", cfg.Gemini.Model)
+	}
+	if cfg.RateLimit.MaxRequests != 7 {
+		t.Errorf("RateLimit.MaxRequests = %d", cfg.RateLimit.MaxRequests)
+	}
+	if cfg.Search.SessionTTL != Duration(5*time.Minute) {
+		t.Errorf("Search.SessionTTL = %v", time.Duration(cfg.Search.SessionTTL))
+	}
+	if !cfg.Request.StrictJSON {
+		t.Error("Request.StrictJSON was not set")
+	}
+	if cfg.Geo.MaxRadiusKm != 12.5 {
+		t.Errorf("Geo.MaxRadiusKm = %g", cfg.Geo.MaxRadiusKm)
+	}
+	if got := strings.Join(cfg.Auth.APIKeys, ","); got != "one,two" {
+		t.Errorf("Auth.APIKeys = %q", cfg.Auth.APIKeys)
+	}
+	if cfg.Auth.UserKeys["alice"] != "key-a" || cfg.Auth.UserKeys["bob"] != "key-b" || len(cfg.Auth.UserKeys) != 2 {
+		t.Errorf("Auth.UserKeys = %v", cfg.Auth.UserKeys)
+	}
+
+	// Everything not overridden keeps its default
+	if defaults := DefaultConfig(); cfg.Search.MaxPageSize != defaults.Search.MaxPageSize || cfg.Store.Backend != defaults.Store.Backend {
+		t.Errorf("defaults were not kept: %+v", cfg.Search)
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	data := "gemini:\n  model: from-file\nsearch:\n  maxPageSize: 5\n  sessionTtl: 10m\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(envConfigFile, path)
+	t.Setenv(envSearchMaxPageSize, "8")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Gemini.Model != "from-file" || cfg.Search.SessionTTL != Duration(10*time.Minute) {
+		t.Errorf("file values not loaded: model %q, sessionTtl %v", cfg.Gemini.Model, time.Duration(cfg.Search.SessionTTL))
+	}
+	if cfg.Search.MaxPageSize != 8 {
+		t.Errorf("Search.MaxPageSize = %d, want the environment to win over the file", cfg.Search.MaxPageSize)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	toml := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(toml, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		env   map[string]string
+		wants []string
+	}{
+		{"bad int", map[string]string{envSearchMaxPageSize: "ten"}, []string{envSearchMaxPageSize}},
+		{"bad duration", map[string]string{envSearchSessionTTL: "forever"}, []string{envSearchSessionTTL}},
+		{"bad bool", map[string]string{envDebugEndpoints: "maybe"}, []string{envDebugEndpoints}},
+		{"bad user keys", map[string]string{envAuthUserKeys: "alice"}, []string{"name=value"}},
+		{"missing file", map[string]string{envConfigFile: filepath.Join(dir, "missing.yaml")}, []string{"failed to read config file"}},
+		{"unsupported file", map[string]string{envConfigFile: toml}, []string{`unsupported config file extension ".toml"`}},
+		{
+			name: "every problem reported",
+			env: map[string]string{
+				envSearchMaxPageSize:   "0",
+				envLogLevel:            "loud",
+				envStoreBackend:        storeBackendFile,
+				envSearchPublicBaseURL: "ftp://example.com",
+			},
+			wants: []string{
+				"invalid configuration",
+				"search.maxPageSize must be positive",
+				"logging.level must be one of",
+				"store.path is required",
+				"search.publicBaseUrl must be an absolute http or https URL",
+			},
+		},
+		{"duplicate user keys", map[string]string{envAuthUserKeys: "alice=same,bob=same"}, []string{"different, non-empty key"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			_, err := LoadConfig()
+			if err == nil {
+				t.Fatal("LoadConfig() accepted the configuration")
+			}
+			for _, want := range tt.wants {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("LoadConfig() error = %v, want it to mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigRedacted(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Auth.APIKeys = []string{"client-secret"}
+	cfg.Auth.UserKeys = map[string]string{"alice": "user-secret"}
+	cfg.Alerts.RunKey = "run-secret"
+
+	redacted := cfg.Redacted()
+	if redacted.Auth.APIKeys[0] != "[REDACTED]" || redacted.Auth.UserKeys["alice"] != "[REDACTED]" || redacted.Alerts.RunKey != "[REDACTED]" {
+		t.Errorf("Redacted() = %+v %+v", redacted.Auth, redacted.Alerts)
+	}
+	if cfg.Auth.APIKeys[0] != "client-secret" || cfg.Auth.UserKeys["alice"] != "user-secret" || cfg.Alerts.RunKey != "run-secret" {
+		t.Error("Redacted() changed the configuration it copied")
+	}
+	if DefaultConfig().Redacted().Alerts.RunKey != "" {
+		t.Error("an unset run key shows as redacted")
+	}
+}
+
+func TestEffectiveConfigEndpoint(t *testing.T) {
+	userKeys, runKey, endpoints := appConfig.Auth.UserKeys, appConfig.Alerts.RunKey, appConfig.Debug.Endpoints
+	t.Cleanup(func() {
+		appConfig.Auth.UserKeys, appConfig.Alerts.RunKey, appConfig.Debug.Endpoints = userKeys, runKey, endpoints
+	})
+	appConfig.Auth.UserKeys = map[string]string{"alice": "user-secret"}
+	appConfig.Alerts.RunKey = "run-secret"
+
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+		return rec
+	}
+
+	appConfig.Debug.Endpoints = false
+	if rec := get(); rec.Code != http.StatusNotFound {
+		t.Errorf("with debug endpoints off, GET /debug/config = %d, want 404", rec.Code)
+	}
+
+	appConfig.Debug.Endpoints = true
+	rec := get()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /debug/config = %d, want 200", rec.Code)
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "user-secret") || strings.Contains(body, "run-secret") || !strings.Contains(body, "[REDACTED]") {
+		t.Errorf("GET /debug/config leaked a secret: %s", body)
+	}
+}
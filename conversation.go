@@ -0,0 +1,199 @@
+package schoolsout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRefinementLength bounds the follow-up message of a refinement
+const maxRefinementLength = 500
+
+// ErrSearchNotFound is returned when a searchId is unknown or has expired
+var ErrSearchNotFound = errors.New("search not found or has expired")
+
+// RefineRequest is a follow-up to an earlier search, e.g. "cheaper ones"
+type RefineRequest struct {
+	Message string `json:"message"`
+}
+
+// conversation remembers a search so follow-ups can refine it
+type conversation struct {
+	request     SearchRequest // Resolved request, with the Stage 1 turns so far
+	activities  []Activity    // Latest results returned to the client
+	refinements int
+	expires     time.Time
+}
+
+// conversationStore holds refinable searches by search ID.
+// Like paginated searches, they live in this instance's memory, so a search ID
+// only works on the instance that issued it.
+type conversationStore struct {
+	mu            sync.Mutex
+	conversations map[string]*conversation
+}
+
+// conversations is the per-instance store of refinable searches
+var conversations = &conversationStore{conversations: make(map[string]*conversation)}
+
+// start remembers a search and returns its ID, or "" when the search can't be
+// refined: refinement is disabled or Stage 1 never answered
+func (s *conversationStore) start(req *SearchRequest, activities []Activity) string {
+	if appConfig.Search.MaxRefinements == 0 || len(req.history) == 0 {
+		return ""
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.prune(now)
+	id := newRequestID()
+	s.conversations[id] = &conversation{
+		request:    *req,
+		activities: append([]Activity(nil), activities...),
+		expires:    now.Add(time.Duration(appConfig.Search.SessionTTL)),
+	}
+	return id
+}
+
+// begin counts a refinement of a search and returns a copy of its request,
+// prepared to send message as the next turn of its conversation. Counting here,
+// under the lock, keeps concurrent follow-ups within the limit; cancel gives
+// the refinement back when it fails.
+func (s *conversationStore) begin(id, message string) (SearchRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conv, ok := s.conversations[id]
+	if !ok || time.Now().After(conv.expires) {
+		delete(s.conversations, id)
+		return SearchRequest{}, ErrSearchNotFound
+	}
+	if conv.refinements >= appConfig.Search.MaxRefinements {
+		return SearchRequest{}, fmt.Errorf("a search can be refined at most %d times; start a new search", appConfig.Search.MaxRefinements)
+	}
+	conv.refinements++
+
+	req := conv.request
+	req.history = append([]Content(nil), conv.request.history...)
+	req.refinement = refinementPrompt(message, conv.activities)
+	return req, nil
+}
+
+// finish records the outcome of a refinement
+func (s *conversationStore) finish(id string, req *SearchRequest, activities []Activity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conv, ok := s.conversations[id]
+	if !ok {
+		return // Expired while the refinement ran
+	}
+	conv.request.history = req.history
+	conv.activities = append([]Activity(nil), activities...)
+	conv.expires = time.Now().Add(time.Duration(appConfig.Search.SessionTTL))
+}
+
+// cancel gives back a refinement counted by begin that didn't change the conversation
+func (s *conversationStore) cancel(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if conv, ok := s.conversations[id]; ok && conv.refinements > 0 {
+		conv.refinements--
+	}
+}
+
+// prune removes expired conversations. Caller must hold s.mu.
+func (s *conversationStore) prune(now time.Time) {
+	for id, conv := range s.conversations {
+		if now.After(conv.expires) {
+			delete(s.conversations, id)
+		}
+	}
+}
+
+// refinementPrompt builds the Stage 1 follow-up turn. It names the activities the
+// client was shown, since filters and ranking may have dropped some of the ones
+// Gemini listed in its previous answer. The message and titles are client and
+// model text, so each is kept to its own line like the search prompt's fields.
+func refinementPrompt(message string, shown []Activity) string {
+	prompt := fmt.Sprintf("Refine the activities you found based on this follow-up request: %s\n\n", promptText(message))
+	if len(shown) > 0 {
+		prompt += "The activities I was shown were:\n"
+		for _, activity := range shown {
+			prompt += fmt.Sprintf("- %s\n", promptText(activity.Title))
+		}
+		prompt += "\n"
+	}
+	prompt += "Keep the activities that still fit the request and use Google Search to find others that do. " +
+		"List every activity again, each with its direct official URL, in the same format as before."
+	return prompt
+}
+
+// handleRefineSearch sends a follow-up to an earlier search and returns the
+// refined activities (POST /v1/searches/{searchId}/refine)
+func handleRefineSearch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	searchID := r.PathValue("searchId")
+
+	var body RefineRequest
+	if status, err := decodeJSONBody(w, r, &body); err != nil {
+		logger.WarnContext(ctx, "Invalid request body", "error", err)
+		sendErrorResponse(w, status, err.Error())
+		return
+	}
+	message := strings.TrimSpace(body.Message)
+	if message == "" {
+		sendErrorResponse(w, http.StatusBadRequest, "message is required")
+		return
+	}
+	if len(message) > maxRefinementLength {
+		sendErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("message must be at most %d characters", maxRefinementLength))
+		return
+	}
+
+	// Refuse follow-ups once the daily token budget is used up
+	if err := dailyBudgetError(); err != nil {
+		sendSearchError(ctx, w, err)
+		return
+	}
+
+	searchRequest, err := conversations.begin(searchID, message)
+	if errors.Is(err, ErrSearchNotFound) {
+		sendErrorResponse(w, http.StatusNotFound, "Search not found or has expired")
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	logger.InfoContext(ctx, "Refining search", "searchId", searchID, "message", message)
+	ctx = withGroundingCollector(withUsageTracker(ctx))
+	activities, err := performSearch(ctx, &searchRequest)
+	if err != nil {
+		conversations.cancel(searchID)
+		sendSearchError(ctx, w, err)
+		return
+	}
+
+	// A follow-up that found nothing leaves the conversation as it was so the
+	// client can rephrase
+	found := len(activities)
+	response := searchResponse(ctx, &searchRequest, activities, nil)
+	response.SearchID = searchID
+	if found > 0 {
+		conversations.finish(searchID, &searchRequest, response.Activities)
+	} else {
+		conversations.cancel(searchID)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,151 @@
+package schoolsout
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useMaxRefinements sets search.maxRefinements for the rest of the test
+func useMaxRefinements(t *testing.T, limit int) {
+	previous := appConfig.Search.MaxRefinements
+	appConfig.Search.MaxRefinements = limit
+	t.Cleanup(func() { appConfig.Search.MaxRefinements = previous })
+}
+
+// postJSON sends a JSON body through the router and decodes the SearchResponse
+func postJSON(t *testing.T, path string, body any) (int, SearchResponse) {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var response SearchResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("POST %s: %v", path, err)
+	}
+	return rec.Code, response
+}
+
+func TestConversationStoreLimitsRefinements(t *testing.T) {
+	useMaxRefinements(t, 2)
+	store := &conversationStore{conversations: make(map[string]*conversation)}
+	id := store.start(&SearchRequest{Query: "zoo", history: []Content{{Role: roleUser}}}, nil)
+	if id == "" {
+		t.Fatal("start returned no search ID")
+	}
+
+	// Concurrent follow-ups can't get past the limit between check and update
+	var started atomic.Int32
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := store.begin(id, "cheaper"); err == nil {
+				started.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if started.Load() != 2 {
+		t.Fatalf("%d refinements began, want 2", started.Load())
+	}
+
+	// A refinement that failed is given back
+	store.cancel(id)
+	if _, err := store.begin(id, "cheaper"); err != nil {
+		t.Errorf("begin after cancel = %v", err)
+	}
+	if _, err := store.begin(id, "cheaper"); err == nil || errors.Is(err, ErrSearchNotFound) {
+		t.Errorf("begin past the limit = %v, want the limit error", err)
+	}
+}
+
+func TestConversationStoreExpires(t *testing.T) {
+	useMaxRefinements(t, 5)
+	store := &conversationStore{conversations: make(map[string]*conversation)}
+	if id := store.start(&SearchRequest{Query: "zoo"}, nil); id != "" {
+		t.Errorf("a search Stage 1 never answered got search ID %q", id)
+	}
+
+	id := store.start(&SearchRequest{Query: "zoo", history: []Content{{Role: roleUser}}}, nil)
+	store.conversations[id].expires = time.Now().Add(-time.Second)
+	if _, err := store.begin(id, "cheaper"); !errors.Is(err, ErrSearchNotFound) {
+		t.Errorf("begin on an expired search = %v, want ErrSearchNotFound", err)
+	}
+	if _, err := store.begin("unknown", "cheaper"); !errors.Is(err, ErrSearchNotFound) {
+		t.Errorf("begin on an unknown search = %v, want ErrSearchNotFound", err)
+	}
+}
+
+func TestRefineSearch(t *testing.T) {
+	useMaxRefinements(t, 1)
+	gemini := useFakeGemini(t,
+		Activity{Title: "Zoo day", Category: "outdoor", Price: "$30", BookingURL: "https://zoo.example.com/day"},
+		Activity{Title: "Museum tour", Category: "educational", Price: "$10", BookingURL: "https://museum.example.com/tour"},
+	)
+
+	status, search := postJSON(t, "/v1/search", SearchRequest{Query: "things to do"})
+	if status != http.StatusOK || search.SearchID == "" || len(search.Activities) != 2 {
+		t.Fatalf("search = %d %+v, want 200 with a search ID and 2 activities", status, search)
+	}
+
+	gemini.setActivities(Activity{Title: "Free park", Category: "outdoor", Price: "Free", BookingURL: "https://park.example.com/"})
+	status, refined := postJSON(t, "/v1/searches/"+search.SearchID+"/refine", RefineRequest{Message: "only free ones"})
+	if status != http.StatusOK || refined.SearchID != search.SearchID {
+		t.Fatalf("refine = %d %+v, want 200 with the same search ID", status, refined)
+	}
+	if len(refined.Activities) != 1 || refined.Activities[0].Title != "Free park" || refined.Facets == nil {
+		t.Errorf("refined activities = %+v, facets %+v", refined.Activities, refined.Facets)
+	}
+
+	// The follow-up continues the conversation and names what the client saw
+	searches := gemini.searchRequests()
+	if len(searches) != 2 {
+		t.Fatalf("%d Google Search calls, want 2", len(searches))
+	}
+	contents := searches[1].Contents
+	if len(contents) != 3 || contents[0].Role != roleUser || contents[1].Role != roleModel || contents[2].Role != roleUser {
+		t.Fatalf("follow-up contents = %+v, want user, model, user turns", contents)
+	}
+	followUp := contents[2].Parts[0].Text
+	if !strings.Contains(followUp, "only free ones") || !strings.Contains(followUp, "- Zoo day") || !strings.Contains(followUp, "- Museum tour") {
+		t.Errorf("follow-up prompt = %q", followUp)
+	}
+
+	status, limited := postJSON(t, "/v1/searches/"+search.SearchID+"/refine", RefineRequest{Message: "nearer"})
+	if status != http.StatusBadRequest || limited.ErrorCode != errorCodeInvalidRequest {
+		t.Errorf("refine past the limit = %d %q, want 400 %s", status, limited.ErrorCode, errorCodeInvalidRequest)
+	}
+	if status, _ := postJSON(t, "/v1/searches/unknown/refine", RefineRequest{Message: "nearer"}); status != http.StatusNotFound {
+		t.Errorf("refine of an unknown search = %d, want 404", status)
+	}
+	if status, _ := postJSON(t, "/v1/searches/"+search.SearchID+"/refine", RefineRequest{Message: " "}); status != http.StatusBadRequest {
+		t.Errorf("refine without a message = %d, want 400", status)
+	}
+}
+
+func TestFailedRefinementIsNotCounted(t *testing.T) {
+	useMaxRefinements(t, 1)
+	gemini := useFakeGemini(t, Activity{Title: "Zoo day", Category: "outdoor", BookingURL: "https://zoo.example.com/day"})
+	_, search := postJSON(t, "/v1/search", SearchRequest{Query: "things to do"})
+
+	gemini.setStatus(http.StatusInternalServerError)
+	if status, _ := postJSON(t, "/v1/searches/"+search.SearchID+"/refine", RefineRequest{Message: "cheaper"}); status != http.StatusBadGateway {
+		t.Fatalf("refine with Gemini failing = %d, want 502", status)
+	}
+	gemini.setStatus(0)
+	if status, _ := postJSON(t, "/v1/searches/"+search.SearchID+"/refine", RefineRequest{Message: "cheaper"}); status != http.StatusOK {
+		t.Errorf("refine after a failed one = %d, want 200", status)
+	}
+}
@@ -0,0 +1,253 @@
+package schoolsout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// envGeminiAPIKey is the environment variable consulted first for the Gemini API key
+const envGeminiAPIKey = "GEMINI_API_KEY"
+
+// startupCredentialTimeout bounds resolving the API key at startup, so an
+// unreachable Secret Manager can't hang a cold start
+const startupCredentialTimeout = 10 * time.Second
+
+// ErrCredentialNotConfigured is returned by a provider that has nothing to offer
+// (e.g. its env var or file is not set), so the chain moves on to the next one
+var ErrCredentialNotConfigured = errors.New("not configured")
+
+// CredentialProvider supplies the Gemini API key from a single source
+type CredentialProvider interface {
+	Name() string
+	APIKey(ctx context.Context) (string, error)
+}
+
+// EnvCredentialProvider reads the API key from an environment variable
+type EnvCredentialProvider struct {
+	Var string
+}
+
+// Name implements CredentialProvider
+func (p *EnvCredentialProvider) Name() string {
+	return "env " + p.Var
+}
+
+// APIKey implements CredentialProvider
+func (p *EnvCredentialProvider) APIKey(ctx context.Context) (string, error) {
+	key := strings.TrimSpace(os.Getenv(p.Var))
+	if key == "" {
+		return "", ErrCredentialNotConfigured
+	}
+	return key, nil
+}
+
+// FileCredentialProvider reads the API key from a file, e.g. a secret mounted as a volume
+type FileCredentialProvider struct {
+	Path string
+}
+
+// Name implements CredentialProvider
+func (p *FileCredentialProvider) Name() string {
+	if p.Path == "" {
+		return "file (unset)"
+	}
+	return "file " + p.Path
+}
+
+// APIKey implements CredentialProvider
+func (p *FileCredentialProvider) APIKey(ctx context.Context) (string, error) {
+	if p.Path == "" {
+		return "", ErrCredentialNotConfigured
+	}
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read key file: %w", err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("key file is empty")
+	}
+	return key, nil
+}
+
+// SecretManagerCredentialProvider reads the API key from Google Cloud Secret Manager
+type SecretManagerCredentialProvider struct {
+	ProjectID string
+	Secret    string
+	Version   string
+}
+
+// Name implements CredentialProvider
+func (p *SecretManagerCredentialProvider) Name() string {
+	return fmt.Sprintf("secret manager %s/%s", p.Secret, p.Version)
+}
+
+// APIKey implements CredentialProvider
+func (p *SecretManagerCredentialProvider) APIKey(ctx context.Context) (string, error) {
+	if p.ProjectID == "" {
+		return "", fmt.Errorf("%w: no GCP project ID found in environment (GOOGLE_CLOUD_PROJECT or GCP_PROJECT_ID)", ErrCredentialNotConfigured)
+	}
+	key, err := getSecretValue(ctx, p.ProjectID, p.Secret, p.Version)
+	if err != nil {
+		return "", err
+	}
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return "", fmt.Errorf("secret is empty")
+	}
+	return key, nil
+}
+
+// FakeCredentialProvider returns a fixed key or error, for tests and local runs
+type FakeCredentialProvider struct {
+	Key string
+	Err error
+}
+
+// Name implements CredentialProvider
+func (p *FakeCredentialProvider) Name() string {
+	return "fake"
+}
+
+// APIKey implements CredentialProvider
+func (p *FakeCredentialProvider) APIKey(ctx context.Context) (string, error) {
+	if p.Err != nil {
+		return "", p.Err
+	}
+	if p.Key == "" {
+		return "", ErrCredentialNotConfigured
+	}
+	return p.Key, nil
+}
+
+// CredentialChain tries each provider in order and returns the first key found
+type CredentialChain []CredentialProvider
+
+// Name implements CredentialProvider
+func (chain CredentialChain) Name() string {
+	names := make([]string, len(chain))
+	for i, provider := range chain {
+		names[i] = provider.Name()
+	}
+	return "chain [" + strings.Join(names, ", ") + "]"
+}
+
+// APIKey implements CredentialProvider. When no provider succeeds, the error lists
+// why each one failed.
+func (chain CredentialChain) APIKey(ctx context.Context) (string, error) {
+	var failures []string
+	for _, provider := range chain {
+		key, err := provider.APIKey(ctx)
+		if err == nil {
+			logger.DebugContext(ctx, "Using Gemini API key", "provider", provider.Name())
+			return key, nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", provider.Name(), err))
+	}
+	return "", fmt.Errorf("no Gemini API key available (%s)", strings.Join(failures, "; "))
+}
+
+// cachedCredentialProvider remembers the key returned by a provider for ttl, so a
+// rotated secret is picked up; a zero ttl keeps it until invalidate. Failures are
+// not cached so that transient errors are retried on the next call.
+type cachedCredentialProvider struct {
+	provider CredentialProvider
+	ttl      time.Duration
+
+	mu        sync.Mutex
+	key       string
+	fetchedAt time.Time
+}
+
+// Name implements CredentialProvider
+func (p *cachedCredentialProvider) Name() string {
+	return p.provider.Name()
+}
+
+// APIKey implements CredentialProvider. The lock is not held while the provider
+// runs, so a slow Secret Manager call doesn't queue every search behind it.
+func (p *cachedCredentialProvider) APIKey(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	key := p.key
+	fresh := key != "" && (p.ttl <= 0 || time.Since(p.fetchedAt) < p.ttl)
+	p.mu.Unlock()
+
+	metrics.recordCacheLookup(ctx, "credentials", fresh)
+	if fresh {
+		return key, nil
+	}
+	key, err := p.provider.APIKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	registerSecret(key)
+
+	p.mu.Lock()
+	if key != p.key {
+		logger.InfoContext(ctx, "Resolved Gemini API key", "provider", p.provider.Name())
+	}
+	p.key, p.fetchedAt = key, time.Now()
+	p.mu.Unlock()
+	return key, nil
+}
+
+// invalidate forgets key, if it is still the cached one, so the next call
+// resolves the key again
+func (p *cachedCredentialProvider) invalidate(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.key == key {
+		p.key = ""
+	}
+}
+
+// invalidateCredentials drops a key Gemini rejected from the default credential
+// cache, so a rotated secret is used from the next search on
+func invalidateCredentials(key string) {
+	if cached, ok := defaultCredentials.(*cachedCredentialProvider); ok {
+		cached.invalidate(key)
+	}
+}
+
+// defaultCredentials is the provider chain used by NewGeminiClient
+var defaultCredentials CredentialProvider = &cachedCredentialProvider{
+	provider: newDefaultCredentialChain(appConfig),
+	ttl:      time.Duration(appConfig.Gemini.APIKeyCacheTTL),
+}
+
+// newDefaultCredentialChain builds the env var -> mounted file -> Secret Manager chain
+func newDefaultCredentialChain(cfg *Config) CredentialChain {
+	return CredentialChain{
+		&EnvCredentialProvider{Var: envGeminiAPIKey},
+		&FileCredentialProvider{Path: cfg.Gemini.APIKeyFile},
+		&SecretManagerCredentialProvider{
+			ProjectID: gcpProjectID(),
+			Secret:    cfg.Gemini.APIKeySecret,
+			Version:   cfg.Gemini.APIKeySecretVersion,
+		},
+	}
+}
+
+// gcpProjectID returns the GCP project ID from the environment
+func gcpProjectID() string {
+	// Cloud Functions Gen2 sets GOOGLE_CLOUD_PROJECT automatically
+	if projectID := os.Getenv("GOOGLE_CLOUD_PROJECT"); projectID != "" {
+		return projectID
+	}
+	return os.Getenv("GCP_PROJECT_ID")
+}
+
+// init resolves the API key once at startup so a missing credential is reported
+// immediately rather than on the first search
+func init() {
+	ctx, cancel := context.WithTimeout(context.Background(), startupCredentialTimeout)
+	defer cancel()
+	if _, err := defaultCredentials.APIKey(ctx); err != nil {
+		logger.Error("Gemini API key unavailable at startup", "error", err)
+	}
+}
@@ -0,0 +1,208 @@
+package schoolsout
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCredentialChainOrder(t *testing.T) {
+	failing := errors.New("permission denied")
+	tests := []struct {
+		name    string
+		chain   CredentialChain
+		want    string
+		wantErr []string // Substrings of the error, in order
+	}{
+		{
+			name:  "first provider wins",
+			chain: CredentialChain{&FakeCredentialProvider{Key: "env-key"}, &FakeCredentialProvider{Key: "file-key"}},
+			want:  "env-key",
+		},
+		{
+			name:  "unconfigured providers are skipped",
+			chain: CredentialChain{&FakeCredentialProvider{}, &FakeCredentialProvider{Key: "file-key"}},
+			want:  "file-key",
+		},
+		{
+			name:  "failing providers are skipped",
+			chain: CredentialChain{&FakeCredentialProvider{Err: failing}, &FakeCredentialProvider{Key: "secret-key"}},
+			want:  "secret-key",
+		},
+		{
+			name:    "every failure is reported",
+			chain:   CredentialChain{&FakeCredentialProvider{}, &FakeCredentialProvider{Err: failing}},
+			wantErr: []string{"fake: not configured", "fake: permission denied"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := tt.chain.APIKey(context.Background())
+			if tt.wantErr == nil {
+				if err != nil || key != tt.want {
+					t.Fatalf("APIKey() = %q, %v; want %q", key, err, tt.want)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("APIKey() = %q, want an error", key)
+			}
+			rest := err.Error()
+			for _, want := range tt.wantErr {
+				i := strings.Index(rest, want)
+				if i < 0 {
+					t.Fatalf("error %q does not list %q in order", err, want)
+				}
+				rest = rest[i+len(want):]
+			}
+		})
+	}
+}
+
+func TestCachedCredentialProviderRetriesFailures(t *testing.T) {
+	fake := &FakeCredentialProvider{Err: errors.New("unavailable")}
+	cached := &cachedCredentialProvider{provider: fake}
+
+	if _, err := cached.APIKey(context.Background()); err == nil {
+		t.Fatal("APIKey() succeeded, want the provider's error")
+	}
+	fake.Err, fake.Key = nil, "key"
+	if key, err := cached.APIKey(context.Background()); err != nil || key != "key" {
+		t.Fatalf("APIKey() after recovery = %q, %v; want %q", key, err, "key")
+	}
+	fake.Key = "rotated"
+	if key, _ := cached.APIKey(context.Background()); key != "key" {
+		t.Errorf("APIKey() = %q, want the cached %q", key, "key")
+	}
+}
+
+func TestCachedCredentialProviderExpires(t *testing.T) {
+	fake := &FakeCredentialProvider{Key: "key"}
+	cached := &cachedCredentialProvider{provider: fake, ttl: time.Hour}
+	if key, _ := cached.APIKey(context.Background()); key != "key" {
+		t.Fatalf("APIKey() = %q, want %q", key, "key")
+	}
+
+	fake.Key = "rotated"
+	if key, _ := cached.APIKey(context.Background()); key != "key" {
+		t.Errorf("APIKey() within the TTL = %q, want the cached %q", key, "key")
+	}
+	cached.fetchedAt = time.Now().Add(-2 * time.Hour)
+	if key, _ := cached.APIKey(context.Background()); key != "rotated" {
+		t.Errorf("APIKey() after the TTL = %q, want %q", key, "rotated")
+	}
+}
+
+func TestCachedCredentialProviderInvalidate(t *testing.T) {
+	fake := &FakeCredentialProvider{Key: "key"}
+	cached := &cachedCredentialProvider{provider: fake}
+	cached.APIKey(context.Background())
+	fake.Key = "rotated"
+
+	// Only the key that was rejected is dropped
+	cached.invalidate("older")
+	if key, _ := cached.APIKey(context.Background()); key != "key" {
+		t.Errorf("APIKey() = %q after invalidating another key, want %q", key, "key")
+	}
+	cached.invalidate("key")
+	if key, _ := cached.APIKey(context.Background()); key != "rotated" {
+		t.Errorf("APIKey() = %q after invalidate, want %q", key, "rotated")
+	}
+}
+
+// blockingCredentialProvider waits for release before returning its key
+type blockingCredentialProvider struct {
+	started, release chan struct{}
+}
+
+func (p *blockingCredentialProvider) Name() string { return "blocking" }
+
+func (p *blockingCredentialProvider) APIKey(ctx context.Context) (string, error) {
+	close(p.started)
+	<-p.release
+	return "key", nil
+}
+
+func TestCachedCredentialProviderUnlockedDuringFetch(t *testing.T) {
+	provider := &blockingCredentialProvider{started: make(chan struct{}), release: make(chan struct{})}
+	cached := &cachedCredentialProvider{provider: provider}
+	done := make(chan struct{})
+	go func() {
+		cached.APIKey(context.Background())
+		close(done)
+	}()
+	<-provider.started
+
+	locked := make(chan struct{})
+	go func() {
+		cached.invalidate("other")
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Error("the cache stayed locked while the provider ran")
+	}
+	close(provider.release)
+	<-done
+}
+
+func TestGeminiRejectionInvalidatesKey(t *testing.T) {
+	gemini := useFakeGemini(t)
+	source := &FakeCredentialProvider{Key: "old-key"}
+	defaultCredentials = &cachedCredentialProvider{provider: source, ttl: time.Hour}
+
+	client := NewGeminiClient(context.Background())
+	source.Key = "new-key"
+	gemini.setStatus(http.StatusForbidden)
+	if err := client.getModel(context.Background()); err == nil {
+		t.Fatal("getModel succeeded, want the rejection")
+	}
+	if key, _ := defaultCredentials.APIKey(context.Background()); key != "new-key" {
+		t.Errorf("APIKey() after a 403 = %q, want the rotated key", key)
+	}
+}
+
+func TestDefaultCredentialChain(t *testing.T) {
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "")
+	t.Setenv("GCP_PROJECT_ID", "")
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("file-key\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	cfg.Gemini.APIKeyFile = keyFile
+
+	chain := newDefaultCredentialChain(cfg)
+	if len(chain) != 3 {
+		t.Fatalf("chain has %d providers, want env, file and Secret Manager", len(chain))
+	}
+	if env, ok := chain[0].(*EnvCredentialProvider); !ok || env.Var != envGeminiAPIKey {
+		t.Errorf("first provider = %s, want env %s", chain[0].Name(), envGeminiAPIKey)
+	}
+	if file, ok := chain[1].(*FileCredentialProvider); !ok || file.Path != keyFile {
+		t.Errorf("second provider = %s, want file %s", chain[1].Name(), keyFile)
+	}
+	if secret, ok := chain[2].(*SecretManagerCredentialProvider); !ok ||
+		secret.Secret != cfg.Gemini.APIKeySecret || secret.Version != cfg.Gemini.APIKeySecretVersion {
+		t.Errorf("third provider = %s, want Secret Manager %s/%s", chain[2].Name(), cfg.Gemini.APIKeySecret, cfg.Gemini.APIKeySecretVersion)
+	}
+
+	t.Setenv(envGeminiAPIKey, "env-key")
+	if key, err := chain.APIKey(context.Background()); err != nil || key != "env-key" {
+		t.Errorf("with the env var set, APIKey() = %q, %v; want env-key", key, err)
+	}
+	t.Setenv(envGeminiAPIKey, "")
+	if key, err := chain.APIKey(context.Background()); err != nil || key != "file-key" {
+		t.Errorf("with the key file, APIKey() = %q, %v; want file-key", key, err)
+	}
+	os.Remove(keyFile)
+	if _, err := chain.APIKey(context.Background()); err == nil || !strings.Contains(err.Error(), "secret manager") {
+		t.Errorf("without env or file, APIKey() error = %v, want Secret Manager's", err)
+	}
+}
@@ -0,0 +1,150 @@
+package schoolsout
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// groundingRedirectHost serves the redirect URLs Google Search grounding returns.
+// Every activity can carry one, so its domain says nothing about the venue.
+const groundingRedirectHost = "vertexaisearch.cloud.google.com"
+
+// dedupeActivities merges activities that describe the same thing: the same
+// normalised title, or the same booking domain at the same location (e.g. a zoo
+// listed under two program names). The first activity of each cluster keeps its
+// position and its empty fields are filled from the others.
+func dedupeActivities(activities []Activity) []Activity {
+	merged := make([]Activity, 0, len(activities))
+	clusterByKey := make(map[string]int)
+
+	for _, activity := range activities {
+		keys := dedupKeys(activity)
+
+		cluster := -1
+		for _, key := range keys {
+			if i, ok := clusterByKey[key]; ok {
+				cluster = i
+				break
+			}
+		}
+		if cluster == -1 {
+			cluster = len(merged)
+			merged = append(merged, activity)
+		} else {
+			merged[cluster] = mergeActivities(merged[cluster], activity)
+		}
+
+		for _, key := range keys {
+			if _, ok := clusterByKey[key]; !ok {
+				clusterByKey[key] = cluster
+			}
+		}
+	}
+
+	return merged
+}
+
+// dedupKeys returns the keys under which an activity is considered a duplicate
+func dedupKeys(activity Activity) []string {
+	var keys []string
+	if title := normalizeTitle(activity.Title); title != "" {
+		keys = append(keys, "title:"+title)
+	}
+	domain := canonicalDomain(activity.BookingURL)
+	location := normalizeTitle(activity.Location)
+	if domain != "" && location != "" {
+		keys = append(keys, "venue:"+domain+"|"+location)
+	}
+	return keys
+}
+
+// mergeActivities fills the empty fields of a from b
+func mergeActivities(a, b Activity) Activity {
+	fill := func(dst *string, src string) {
+		if strings.TrimSpace(*dst) == "" {
+			*dst = src
+		}
+	}
+	fill(&a.Description, b.Description)
+	fill(&a.Category, b.Category)
+	fill(&a.Location, b.Location)
+	fill(&a.AgeRange, b.AgeRange)
+	fill(&a.Date, b.Date)
+	fill(&a.StartTime, b.StartTime)
+	fill(&a.EndTime, b.EndTime)
+	fill(&a.Price, b.Price)
+	fill(&a.ImageURL, b.ImageURL)
+	fill(&a.BookingURL, b.BookingURL)
+	fill(&a.Setting, b.Setting)
+	fill(&a.Accessibility, b.Accessibility)
+	return a
+}
+
+// assignActivityIDs replaces the IDs Gemini made up ("activity-1", ...) with
+// deterministic IDs, so clients recognise, deep-link and favourite the same
+// activity across searches
+func assignActivityIDs(activities []Activity) {
+	for i := range activities {
+		activities[i].ID = activityID(activities[i])
+	}
+}
+
+// activityID hashes the canonical booking URL, normalised title and normalised
+// location of an activity. A grounding redirect differs on every call, so it is
+// left out and the title and location alone identify the activity.
+func activityID(activity Activity) string {
+	var bookingURL string
+	if !isGroundingRedirect(activity.BookingURL) {
+		bookingURL = canonicalURL(activity.BookingURL)
+	}
+	key := bookingURL + "|" + normalizeTitle(activity.Title) + "|" + normalizeTitle(activity.Location)
+	sum := sha256.Sum256([]byte(key))
+	return "act-" + hex.EncodeToString(sum[:8])
+}
+
+// canonicalURL reduces a booking URL to its domain and path, dropping the
+// scheme, "www.", query, fragment and trailing slash, or "" when it has no
+// canonical domain
+func canonicalURL(rawURL string) string {
+	domain := canonicalDomain(rawURL)
+	if domain == "" {
+		return ""
+	}
+	u, _ := url.Parse(strings.TrimSpace(rawURL))
+	return domain + strings.TrimSuffix(strings.ToLower(u.EscapedPath()), "/")
+}
+
+// canonicalDomain returns the host of a booking URL without "www.", or "" for
+// grounding redirects and URLs that don't parse
+func canonicalDomain(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if host == groundingRedirectHost {
+		return ""
+	}
+	return host
+}
+
+// isGroundingRedirect reports whether a booking URL is a Google Search grounding redirect
+func isGroundingRedirect(rawURL string) bool {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	return err == nil && strings.EqualFold(u.Hostname(), groundingRedirectHost)
+}
+
+// normalizeTitle folds case, punctuation and whitespace and drops a leading
+// "the" so near-identical titles compare equal
+func normalizeTitle(title string) string {
+	fields := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(fields) > 1 && fields[0] == "the" {
+		fields = fields[1:]
+	}
+	return strings.Join(fields, " ")
+}
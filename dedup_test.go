@@ -0,0 +1,111 @@
+package schoolsout
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDedupeActivities(t *testing.T) {
+	tests := []struct {
+		name       string
+		activities []Activity
+		want       string // Titles of the merged activities
+	}{
+		{
+			name:       "same title",
+			activities: []Activity{{Title: "The Zoo Day!"}, {Title: "zoo  day"}, {Title: "Aquarium"}},
+			want:       "The Zoo Day!|Aquarium",
+		},
+		{
+			name: "same venue",
+			activities: []Activity{
+				{Title: "Zoo holiday program", Location: "Perth", BookingURL: "https://www.perthzoo.example/kids"},
+				{Title: "Zoo keeper for a day", Location: "perth", BookingURL: "https://perthzoo.example/keeper?ref=1"},
+			},
+			want: "Zoo holiday program",
+		},
+		{
+			name: "same domain at another location",
+			activities: []Activity{
+				{Title: "Swim school", Location: "Perth", BookingURL: "https://swim.example/perth"},
+				{Title: "Swim camp", Location: "Fremantle", BookingURL: "https://swim.example/fremantle"},
+			},
+			want: "Swim school|Swim camp",
+		},
+		{
+			name: "grounding redirects don't make a venue",
+			activities: []Activity{
+				{Title: "Zoo", Location: "Perth", BookingURL: "https://vertexaisearch.cloud.google.com/grounding-api-redirect/a"},
+				{Title: "Museum", Location: "Perth", BookingURL: "https://vertexaisearch.cloud.google.com/grounding-api-redirect/b"},
+			},
+			want: "Zoo|Museum",
+		},
+		{
+			name: "a later key joins an earlier cluster",
+			activities: []Activity{
+				{Title: "Zoo day", Location: "Perth", BookingURL: "https://zoo.example/"},
+				{Title: "Zoo keeper", Location: "Perth", BookingURL: "https://zoo.example/keeper"},
+				{Title: "zoo keeper"},
+			},
+			want: "Zoo day",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := activityTitles(dedupeActivities(tt.activities)); got != tt.want {
+				t.Errorf("dedupeActivities() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupeActivitiesMerges(t *testing.T) {
+	merged := dedupeActivities([]Activity{
+		{Title: "Zoo day", Price: "$20"},
+		{Title: "Zoo Day", Price: "$30", Description: "Meet the animals", Date: "2027-07-05"},
+	})
+	if len(merged) != 1 {
+		t.Fatalf("got %d activities, want 1", len(merged))
+	}
+	if merged[0].Price != "$20" || merged[0].Description != "Meet the animals" || merged[0].Date != "2027-07-05" {
+		t.Errorf("merged = %+v, want the first activity's fields filled from the second", merged[0])
+	}
+}
+
+func TestActivityID(t *testing.T) {
+	zoo := Activity{Title: "Zoo day", Location: "Perth WA", BookingURL: "https://www.zoo.example/day/?utm_source=x#book"}
+	id := activityID(zoo)
+	if !strings.HasPrefix(id, "act-") || len(id) != len("act-")+16 {
+		t.Fatalf("activityID() = %q, want act- and 16 hex digits", id)
+	}
+
+	same := []Activity{
+		{Title: "The zoo DAY", Location: "perth, wa", BookingURL: "http://zoo.example/day"},
+		{Title: "Zoo day", Location: "Perth WA", BookingURL: " HTTPS://ZOO.EXAMPLE/day/ ", Description: "Changed", Price: "$5"},
+	}
+	for _, activity := range same {
+		if got := activityID(activity); got != id {
+			t.Errorf("activityID(%+v) = %s, want %s", activity, got, id)
+		}
+	}
+
+	different := []Activity{
+		{Title: "Zoo night", Location: "Perth WA", BookingURL: zoo.BookingURL},
+		{Title: "Zoo day", Location: "Sydney NSW", BookingURL: zoo.BookingURL},
+		{Title: "Zoo day", Location: "Perth WA", BookingURL: "https://zoo.example/night"},
+	}
+	for _, activity := range different {
+		if got := activityID(activity); got == id {
+			t.Errorf("activityID(%+v) = %s, the same as another activity", activity, got)
+		}
+	}
+}
+
+func TestActivityIDIgnoresGroundingRedirects(t *testing.T) {
+	first := Activity{Title: "Zoo day", Location: "Perth", BookingURL: "https://vertexaisearch.cloud.google.com/grounding-api-redirect/AbC"}
+	second := Activity{Title: "Zoo day", Location: "Perth", BookingURL: "https://VERTEXAISEARCH.cloud.google.com/grounding-api-redirect/XyZ"}
+	none := Activity{Title: "Zoo day", Location: "Perth"}
+	if activityID(first) != activityID(second) || activityID(first) != activityID(none) {
+		t.Error("grounding redirects changed the activity ID")
+	}
+}
@@ -0,0 +1,212 @@
+package schoolsout
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// exportColumn is one column of a CSV or spreadsheet export
+type exportColumn struct {
+	header  string
+	numeric bool // Written as a number cell in spreadsheets
+	value   func(Activity) string
+}
+
+// activityColumns are the export columns, in the order of Activity's fields.
+// Append new columns at the end so existing spreadsheets keep working.
+var activityColumns = []exportColumn{
+	{header: "id", value: func(a Activity) string { return a.ID }},
+	{header: "title", value: func(a Activity) string { return a.Title }},
+	{header: "description", value: func(a Activity) string { return a.Description }},
+	{header: "category", value: func(a Activity) string { return a.Category }},
+	{header: "location", value: func(a Activity) string { return a.Location }},
+	{header: "ageRange", value: func(a Activity) string { return a.AgeRange }},
+	{header: "date", value: func(a Activity) string { return a.Date }},
+	{header: "startTime", value: func(a Activity) string { return a.StartTime }},
+	{header: "endTime", value: func(a Activity) string { return a.EndTime }},
+	{header: "price", value: func(a Activity) string { return a.Price }},
+	{header: "imageUrl", value: func(a Activity) string { return a.ImageURL }},
+	{header: "bookingUrl", value: func(a Activity) string { return a.BookingURL }},
+	{header: "setting", value: func(a Activity) string { return a.Setting }},
+	{header: "accessibility", value: func(a Activity) string { return a.Accessibility }},
+	{header: "weatherAdvisory", value: func(a Activity) string { return a.WeatherAdvisory }},
+	{header: "distanceKm", numeric: true, value: func(a Activity) string {
+		if a.DistanceKm == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*a.DistanceKm, 'f', -1, 64)
+	}},
+}
+
+// writeExportResponse sends activities as a CSV or XLSX download, cached like JSON responses
+func writeExportResponse(w http.ResponseWriter, r *http.Request, format string, activities []Activity, maxAge time.Duration) {
+	var body bytes.Buffer
+	var err error
+	if format == formatXLSX {
+		err = writeActivitiesXLSX(&body, activities)
+	} else {
+		err = writeActivitiesCSV(&body, activities)
+	}
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Failed to export activities", "format", format, "error", err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to encode response")
+		return
+	}
+
+	contentType := formatMediaTypes[format]
+	if format == formatCSV {
+		contentType += "; charset=utf-8; header=present"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="activities.`+format+`"`)
+	writeCacheable(w, r, body.Bytes(), maxAge)
+}
+
+// writeActivitiesCSV writes activities as RFC 4180 CSV with a header row.
+// Fields holding commas, quotes or line breaks are quoted.
+func writeActivitiesCSV(w io.Writer, activities []Activity) error {
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+
+	record := make([]string, len(activityColumns))
+	for i, column := range activityColumns {
+		record[i] = column.header
+	}
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+	for _, activity := range activities {
+		for i, column := range activityColumns {
+			record[i] = neutraliseFormula(column.value(activity))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// neutraliseFormula stops spreadsheet apps opening a CSV from running text taken
+// from the web as a formula, by prefixing it with an apostrophe. A value starting
+// with + or - is only a risk when it names a function or cell, so "-", negative
+// prices and phone numbers such as "+61 8 9222 4444" are left alone.
+func neutraliseFormula(value string) string {
+	if value == "" {
+		return value
+	}
+	switch value[0] {
+	case '=', '@', '\t', '\r':
+		return "'" + value
+	case '+', '-':
+		if strings.IndexFunc(value, unicode.IsLetter) >= 0 {
+			return "'" + value
+		}
+	}
+	return value
+}
+
+// Parts of the minimal Office Open XML package written by writeActivitiesXLSX
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Activities" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`
+)
+
+// writeActivitiesXLSX writes activities as a one-sheet XLSX workbook with a header row
+func writeActivitiesXLSX(w io.Writer, activities []Activity) error {
+	var sheet bytes.Buffer
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	headers := make([]string, len(activityColumns))
+	for i, column := range activityColumns {
+		headers[i] = column.header
+	}
+	writeXLSXRow(&sheet, 1, headers, nil)
+	for i, activity := range activities {
+		values := make([]string, len(activityColumns))
+		for j, column := range activityColumns {
+			values[j] = column.value(activity)
+		}
+		writeXLSXRow(&sheet, i+2, values, activityColumns)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+
+	zw := zip.NewWriter(w)
+	parts := []struct {
+		name string
+		data []byte
+	}{
+		{"[Content_Types].xml", []byte(xlsxContentTypes)},
+		{"_rels/.rels", []byte(xlsxRootRels)},
+		{"xl/workbook.xml", []byte(xlsxWorkbook)},
+		{"xl/_rels/workbook.xml.rels", []byte(xlsxWorkbookRels)},
+		{"xl/worksheets/sheet1.xml", sheet.Bytes()},
+	}
+	for _, part := range parts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(part.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeXLSXRow writes one worksheet row. Values of numeric columns are number
+// cells; everything else is an inline string, which spreadsheets never evaluate.
+func writeXLSXRow(sheet *bytes.Buffer, row int, values []string, columns []exportColumn) {
+	fmt.Fprintf(sheet, `<row r="%d">`, row)
+	for i, value := range values {
+		if value == "" {
+			continue
+		}
+		ref := xlsxColumnName(i) + strconv.Itoa(row)
+		if columns != nil && columns[i].numeric {
+			fmt.Fprintf(sheet, `<c r="%s"><v>%s</v></c>`, ref, value)
+			continue
+		}
+		fmt.Fprintf(sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+		xml.EscapeText(sheet, []byte(value))
+		sheet.WriteString(`</t></is></c>`)
+	}
+	sheet.WriteString(`</row>`)
+}
+
+// xlsxColumnName returns the letters of the zero-based column index: A, B, ... Z, AA
+func xlsxColumnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
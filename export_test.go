@@ -0,0 +1,167 @@
+package schoolsout
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNeutraliseFormula(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"Museum visit", "Museum visit"},
+		{"-", "-"},
+		{"-5.50", "-5.50"},
+		{"+61 8 9222 4444", "+61 8 9222 4444"},
+		{"+1 (555) 010-0199", "+1 (555) 010-0199"},
+		{"=1+1", "'=1+1"},
+		{"@SUM(A1:A2)", "'@SUM(A1:A2)"},
+		{"+SUM(A1:A2)", "'+SUM(A1:A2)"},
+		{"-A1", "'-A1"},
+		{"-2+3+cmd|' /C calc'!A0", "'-2+3+cmd|' /C calc'!A0"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+	}
+	for _, tt := range tests {
+		if got := neutraliseFormula(tt.value); got != tt.want {
+			t.Errorf("neutraliseFormula(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+// exportActivities holds the text a CSV or worksheet must carry through unchanged
+func exportActivities() []Activity {
+	distance := 2.5
+	return []Activity{
+		{
+			ID:          "a1",
+			Title:       `Zoo "keeper" day, with lunch`,
+			Description: "Meet the animals.\r\nBring a hat,\nand water.",
+			Location:    "Perth WA",
+			Price:       "$1,250.00",
+			DistanceKm:  &distance,
+		},
+		{ID: "a2", Title: "Café <crafts> & games", Category: "arts"},
+	}
+}
+
+func TestWriteActivitiesCSV(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeActivitiesCSV(&b, exportActivities()); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatalf("export is not valid CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want a header and 2 activities", len(records))
+	}
+
+	want := []string{"id", "title", "description", "category", "location", "ageRange", "date", "startTime", "endTime",
+		"price", "imageUrl", "bookingUrl", "setting", "accessibility", "weatherAdvisory", "distanceKm"}
+	if strings.Join(records[0], ",") != strings.Join(want, ",") {
+		t.Errorf("header = %q, want %q", records[0], want)
+	}
+
+	for i, activity := range exportActivities() {
+		for j, column := range activityColumns {
+			// encoding/csv reads a quoted CRLF back as LF
+			want := strings.ReplaceAll(column.value(activity), "\r\n", "\n")
+			if got := records[i+1][j]; got != want {
+				t.Errorf("row %d %s = %q, want %q", i+1, column.header, got, want)
+			}
+		}
+	}
+}
+
+func TestWriteActivitiesXLSX(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeActivitiesXLSX(&b, exportActivities()); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatalf("export is not a zip file: %v", err)
+	}
+	var data []byte
+	for _, f := range zr.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data == nil {
+		t.Fatal("export has no xl/worksheets/sheet1.xml")
+	}
+
+	var sheet struct {
+		Rows []struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				R      string `xml:"r,attr"`
+				T      string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(data, &sheet); err != nil {
+		t.Fatalf("worksheet is not valid XML: %v", err)
+	}
+	if len(sheet.Rows) != 3 {
+		t.Fatalf("got %d rows, want a header and 2 activities", len(sheet.Rows))
+	}
+
+	cells := make(map[string]string)
+	for i, row := range sheet.Rows {
+		if row.R != i+1 {
+			t.Errorf("row %d is numbered %d", i+1, row.R)
+		}
+		for _, cell := range row.Cells {
+			if cell.T == "inlineStr" {
+				cells[cell.R] = cell.Inline
+			} else {
+				cells[cell.R] = cell.Value
+			}
+		}
+	}
+
+	for ref, want := range map[string]string{
+		"A1": "id",
+		"P1": "distanceKm",
+		"B2": `Zoo "keeper" day, with lunch`,
+		"C2": "Meet the animals.\r\nBring a hat,\nand water.",
+		"J2": "$1,250.00",
+		"P2": "2.5",
+		"B3": "Café <crafts> & games",
+		"D3": "arts",
+	} {
+		if got := cells[ref]; got != want {
+			t.Errorf("cell %s = %q, want %q", ref, got, want)
+		}
+	}
+	if _, ok := cells["P3"]; ok {
+		t.Error("an unknown distance wrote a cell")
+	}
+	for _, cell := range sheet.Rows[1].Cells {
+		if cell.R == "P2" && cell.T != "" {
+			t.Errorf("distance cell has type %q, want a number", cell.T)
+		}
+	}
+}
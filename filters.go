@@ -0,0 +1,176 @@
+package schoolsout
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Activity settings
+const (
+	settingIndoor  = "indoor"
+	settingOutdoor = "outdoor"
+	settingBoth    = "both"
+)
+
+// Price bands counted in SearchFacets.PriceBands
+const (
+	priceBandFree    = "free"
+	priceBandUnder20 = "under20"
+	priceBand20To50  = "20to50"
+	priceBandOver50  = "over50"
+	priceBandUnknown = "unknown"
+)
+
+// SearchFilters narrows search results. Activities with an unknown setting or
+// accessibility don't match a filter on it; activities with an unknown price
+// ("Varies", "See website") don't match maxPrice or freeOnly unless
+// includeUnknownPrice is set.
+type SearchFilters struct {
+	Categories          []string `json:"categories,omitempty"` // Any of these taxonomy categories
+	MaxPrice            *float64 `json:"maxPrice,omitempty"`   // Lowest price at most this
+	FreeOnly            bool     `json:"freeOnly,omitempty"`
+	IncludeUnknownPrice bool     `json:"includeUnknownPrice,omitempty"` // Keep activities whose price isn't known when filtering on price
+	Setting             string   `json:"setting,omitempty"`             // indoor or outdoor; activities for both match either
+	Accessible          bool     `json:"accessible,omitempty"`          // Only activities with accessibility information
+}
+
+// SearchFacets counts the activities found, before filters, per category and price band
+type SearchFacets struct {
+	Categories map[string]int `json:"categories"`
+	PriceBands map[string]int `json:"priceBands"`
+}
+
+// validate checks the filters and maps requested categories onto the taxonomy.
+// The categories are replaced by a new slice, as the client's may be shared with
+// a stored search or an itinerary's constraints.
+func (f *SearchFilters) validate() error {
+	if len(f.Categories) > 0 {
+		categories := make([]string, len(f.Categories))
+		for i, name := range f.Categories {
+			category, err := canonicalCategory(name)
+			if err != nil {
+				return err
+			}
+			categories[i] = category
+		}
+		f.Categories = categories
+	}
+	if f.MaxPrice != nil && *f.MaxPrice < 0 {
+		return fmt.Errorf("filters.maxPrice must not be negative")
+	}
+	switch f.Setting {
+	case "", settingIndoor, settingOutdoor:
+	default:
+		return fmt.Errorf("filters.setting must be indoor or outdoor")
+	}
+	return nil
+}
+
+// empty reports whether no filter is set; includeUnknownPrice alone filters nothing
+func (f *SearchFilters) empty() bool {
+	return f == nil || (len(f.Categories) == 0 && f.MaxPrice == nil && !f.FreeOnly && f.Setting == "" && !f.Accessible)
+}
+
+// apply returns the activities matching every filter
+func (f *SearchFilters) apply(activities []Activity) []Activity {
+	if f.empty() {
+		return activities
+	}
+
+	filtered := activities[:0]
+	for _, activity := range activities {
+		if f.matches(activity) {
+			filtered = append(filtered, activity)
+		}
+	}
+	return filtered
+}
+
+// matches reports whether one activity passes every filter
+func (f *SearchFilters) matches(activity Activity) bool {
+	if len(f.Categories) > 0 {
+		found := false
+		for _, category := range f.Categories {
+			if activity.Category == category {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if f.FreeOnly || f.MaxPrice != nil {
+		price, ok := parsePrice(activity.Price)
+		if !ok && !f.IncludeUnknownPrice {
+			return false
+		}
+		if ok && ((f.FreeOnly && price > 0) || (f.MaxPrice != nil && price > *f.MaxPrice)) {
+			return false
+		}
+	}
+
+	if f.Setting != "" && activity.Setting != f.Setting && activity.Setting != settingBoth {
+		return false
+	}
+	if f.Accessible && strings.TrimSpace(activity.Accessibility) == "" {
+		return false
+	}
+	return true
+}
+
+// searchFacets counts activities per category and price band
+func searchFacets(activities []Activity) *SearchFacets {
+	facets := &SearchFacets{
+		Categories: make(map[string]int),
+		PriceBands: make(map[string]int),
+	}
+	for _, activity := range activities {
+		facets.Categories[activity.Category]++
+		facets.PriceBands[priceBand(activity.Price)]++
+	}
+	return facets
+}
+
+// priceBand returns the band an activity's lowest price falls in
+func priceBand(text string) string {
+	price, ok := parsePrice(text)
+	switch {
+	case !ok:
+		return priceBandUnknown
+	case price == 0:
+		return priceBandFree
+	case price < 20:
+		return priceBandUnder20
+	case price <= 50:
+		return priceBand20To50
+	default:
+		return priceBandOver50
+	}
+}
+
+// normalizeSetting maps Stage 2's free-text setting onto indoor, outdoor or both
+func normalizeSetting(text string) string {
+	text = strings.ToLower(text)
+	indoor := strings.Contains(text, "indoor")
+	outdoor := strings.Contains(text, "outdoor")
+	switch {
+	case indoor && outdoor, strings.Contains(text, "both"):
+		return settingBoth
+	case indoor:
+		return settingIndoor
+	case outdoor:
+		return settingOutdoor
+	}
+	return ""
+}
+
+// inferSetting tags an activity in the Outdoor category as outdoor when Stage 2
+// didn't say where it takes place
+func inferSetting(activity Activity) string {
+	if activity.Setting == "" && activity.Category == "Outdoor" {
+		return settingOutdoor
+	}
+	return activity.Setting
+}
@@ -0,0 +1,117 @@
+package schoolsout
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSearchFiltersApply(t *testing.T) {
+	activities := []Activity{
+		{Title: "Zoo", Category: "Outdoor", Price: "$25", Setting: settingOutdoor},
+		{Title: "Museum", Category: "Educational", Price: "Free entry", Setting: settingIndoor, Accessibility: "Wheelchair access"},
+		{Title: "Cinema", Category: "Entertainment", Price: "$12.50", Setting: settingIndoor},
+		{Title: "Show", Category: "Arts", Price: "Varies", Setting: settingBoth},
+		{Title: "Camp", Category: "Outdoor", Price: "$1,200"},
+	}
+	price := func(amount float64) *float64 { return &amount }
+
+	tests := []struct {
+		name    string
+		filters *SearchFilters
+		want    string
+	}{
+		{"none", nil, "Zoo|Museum|Cinema|Show|Camp"},
+		{"unknown price alone", &SearchFilters{IncludeUnknownPrice: true}, "Zoo|Museum|Cinema|Show|Camp"},
+		{"categories", &SearchFilters{Categories: []string{"Outdoor", "Arts"}}, "Zoo|Show|Camp"},
+		{"max price", &SearchFilters{MaxPrice: price(20)}, "Museum|Cinema"},
+		{"max price with unknown prices", &SearchFilters{MaxPrice: price(20), IncludeUnknownPrice: true}, "Museum|Cinema|Show"},
+		{"max price over a thousand", &SearchFilters{MaxPrice: price(1000)}, "Zoo|Museum|Cinema"},
+		{"free", &SearchFilters{FreeOnly: true}, "Museum"},
+		{"free with unknown prices", &SearchFilters{FreeOnly: true, IncludeUnknownPrice: true}, "Museum|Show"},
+		{"indoor", &SearchFilters{Setting: settingIndoor}, "Museum|Cinema|Show"},
+		{"outdoor", &SearchFilters{Setting: settingOutdoor}, "Zoo|Show"},
+		{"accessible", &SearchFilters{Accessible: true}, "Museum"},
+		{"every filter", &SearchFilters{Categories: []string{"Educational"}, FreeOnly: true, Setting: settingIndoor, Accessible: true}, "Museum"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.filters.apply(append([]Activity(nil), activities...))
+			if titles := activityTitles(got); titles != tt.want {
+				t.Errorf("apply() = %s, want %s", titles, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchFiltersValidate(t *testing.T) {
+	requested := []string{" outdoor", "ARTS"}
+	filters := &SearchFilters{Categories: requested}
+	if err := filters.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(filters.Categories, ","); got != "Outdoor,Arts" {
+		t.Errorf("Categories = %s, want the taxonomy names", got)
+	}
+	if got := strings.Join(requested, ","); got != " outdoor,ARTS" {
+		t.Errorf("validate changed the client's categories to %s", got)
+	}
+
+	negative := -1.0
+	for _, filters := range []*SearchFilters{
+		{Categories: []string{"Cooking"}},
+		{MaxPrice: &negative},
+		{Setting: settingBoth},
+		{Setting: "underwater"},
+	} {
+		if err := filters.validate(); err == nil {
+			t.Errorf("validate(%+v) accepted invalid filters", filters)
+		}
+	}
+}
+
+func TestSearchFiltersQueryRoundTrip(t *testing.T) {
+	values, _ := url.ParseQuery("q=zoo&category=Outdoor,Arts&maxPrice=20&free=true&unknownPrice=true&setting=indoor&accessible=true")
+	req, err := searchRequestFromQuery(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := req.Filters; f == nil || !f.IncludeUnknownPrice || !f.FreeOnly || !f.Accessible || *f.MaxPrice != 20 || f.Setting != settingIndoor {
+		t.Fatalf("filters = %+v", req.Filters)
+	}
+	if got := req.queryValues().Encode(); got != values.Encode() {
+		t.Errorf("queryValues() = %s, want %s", got, values.Encode())
+	}
+
+	if _, err := searchRequestFromQuery(url.Values{"q": {"zoo"}, "unknownPrice": {"maybe"}}); err == nil {
+		t.Error("unknownPrice=maybe was accepted")
+	}
+}
+
+func TestSearchFacets(t *testing.T) {
+	facets := searchFacets([]Activity{
+		{Category: "Outdoor", Price: "Free"},
+		{Category: "Outdoor", Price: "$19.99"},
+		{Category: "Arts", Price: "$20"},
+		{Category: "Arts", Price: "From $50 per child"},
+		{Category: "Sports", Price: "$50.01"},
+		{Category: "Sports", Price: "Contact venue"},
+		{Category: "Other", Price: ""},
+	})
+
+	wantCategories := map[string]int{"Outdoor": 2, "Arts": 2, "Sports": 2, "Other": 1}
+	wantBands := map[string]int{priceBandFree: 1, priceBandUnder20: 1, priceBand20To50: 2, priceBandOver50: 1, priceBandUnknown: 2}
+	for name, want := range wantCategories {
+		if got := facets.Categories[name]; got != want {
+			t.Errorf("Categories[%s] = %d, want %d", name, got, want)
+		}
+	}
+	for band, want := range wantBands {
+		if got := facets.PriceBands[band]; got != want {
+			t.Errorf("PriceBands[%s] = %d, want %d", band, got, want)
+		}
+	}
+	if len(facets.Categories) != len(wantCategories) || len(facets.PriceBands) != len(wantBands) {
+		t.Errorf("facets = %+v, want only the counted categories and bands", facets)
+	}
+}
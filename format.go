@@ -0,0 +1,63 @@
+package schoolsout
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Response formats a client can ask for with ?format= or the Accept header
+const (
+	formatJSON = "json"
+	formatICS  = "ics"
+	formatCSV  = "csv"
+	formatXLSX = "xlsx"
+)
+
+// formatMediaTypes maps response formats to their media types
+var formatMediaTypes = map[string]string{
+	formatJSON: "application/json",
+	formatICS:  "text/calendar",
+	formatCSV:  "text/csv",
+	formatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// responseFormat picks the format of a response among supported, which lists
+// the default first. The format query parameter wins; otherwise the supported
+// media type the Accept header gives the highest q-value is used, the earliest
+// on a tie. A q-value of 0 means the client doesn't accept that type.
+func responseFormat(r *http.Request, supported ...string) (string, error) {
+	if name := strings.ToLower(strings.TrimSpace(r.URL.Query().Get(queryParamFormat))); name != "" {
+		if slices.Contains(supported, name) {
+			return name, nil
+		}
+		return "", fmt.Errorf("%s must be one of %s", queryParamFormat, strings.Join(supported, ", "))
+	}
+
+	best, bestQ := supported[0], 0.0
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil || !(q >= 0 && q <= 1) {
+				continue
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+		for _, name := range supported {
+			if formatMediaTypes[name] == mediaType {
+				best, bestQ = name, q
+				break
+			}
+		}
+	}
+	return best, nil
+}
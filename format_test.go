@@ -0,0 +1,38 @@
+package schoolsout
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		accept string
+		want   string
+	}{
+		{"default", "/v1/search", "", formatJSON},
+		{"query parameter wins", "/v1/search?format=csv", "text/calendar", formatCSV},
+		{"accepted type", "/v1/search", "text/calendar", formatICS},
+		{"first of equal q-values", "/v1/search", "text/csv, text/calendar", formatCSV},
+		{"highest q-value", "/v1/search", "text/csv;q=0.5, text/calendar;q=0.8", formatICS},
+		{"q=0 is not acceptable", "/v1/search", "text/calendar;q=0, application/json", formatJSON},
+		{"only unacceptable types", "/v1/search", "text/calendar;q=0", formatJSON},
+		{"unsupported types", "/v1/search", "text/html, */*;q=0.8", formatJSON},
+		{"invalid q-value", "/v1/search", "text/calendar;q=high, text/csv;q=0.1", formatCSV},
+		{"q-value out of range", "/v1/search", "text/calendar;q=NaN, text/csv;q=2, text/csv;q=0.1", formatCSV},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			got, err := responseFormat(req, formatJSON, formatICS, formatCSV, formatXLSX)
+			if err != nil || got != tt.want {
+				t.Errorf("responseFormat() = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,10 @@
 package schoolsout
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"sync"
@@ -14,6 +15,7 @@ import (
 
 func init() {
 	functions.HTTP("SearchActivities", SearchActivities)
+	functions.HTTP("RunSavedSearches", withRequestLogging(RunSavedSearches))
 }
 
 // AgeRange represents the age filter for activity search
@@ -30,32 +32,133 @@ type DateRange struct {
 
 // SearchRequest represents the request model for activity search
 type SearchRequest struct {
-	Query     string     `json:"query"`
-	Location  string     `json:"location,omitempty"`
-	AgeRange  *AgeRange  `json:"ageRange,omitempty"`
-	DateRange *DateRange `json:"dateRange,omitempty"`
+	Query     string         `json:"query"`
+	Location  string         `json:"location,omitempty"`
+	AgeRange  *AgeRange      `json:"ageRange,omitempty"`
+	DateRange *DateRange     `json:"dateRange,omitempty"`
+	Debug     bool           `json:"debug,omitempty"`     // Include a debug section in the response (when debug aids are enabled)
+	PageSize  int            `json:"pageSize,omitempty"`  // Activities per page; enables pagination
+	PageToken string         `json:"pageToken,omitempty"` // nextPageToken from the previous page
+	RadiusKm  float64        `json:"radiusKm,omitempty"`  // Only return activities this close to Location
+	Sort      string         `json:"sort,omitempty"`      // relevance (default), price, date or distance
+	Filters   *SearchFilters `json:"filters,omitempty"`
+
+	excludeTitles []string        // Activities already returned by earlier pages, set from the page token
+	holiday       *HolidayWindow  // School holidays the dates were resolved to, when none were given
+	place         *Place          // Geocoded Location
+	forecast      []DailyForecast // Weather at place over DateRange
+	history       []Content       // Stage 1 turns of the conversation so far
+	refinement    string          // Stage 1 prompt of a follow-up, used instead of the search prompt
 }
 
 // Activity represents a school holiday activity or event
 type Activity struct {
-	ID          string `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Category    string `json:"category"`
-	Location    string `json:"location,omitempty"`
-	AgeRange    string `json:"ageRange,omitempty"`
-	Date        string `json:"date,omitempty"`
-	Price       string `json:"price,omitempty"`
-	ImageURL    string `json:"imageUrl,omitempty"`
-	BookingURL  string `json:"bookingUrl,omitempty"`
+	ID              string   `json:"id"`
+	Title           string   `json:"title"`
+	Description     string   `json:"description"`
+	Category        string   `json:"category"`
+	Location        string   `json:"location,omitempty"`
+	AgeRange        string   `json:"ageRange,omitempty"`
+	Date            string   `json:"date,omitempty"`
+	StartTime       string   `json:"startTime,omitempty"` // HH:mm, local to the activity; without it the activity lasts all day
+	EndTime         string   `json:"endTime,omitempty"`   // HH:mm
+	Price           string   `json:"price,omitempty"`
+	ImageURL        string   `json:"imageUrl,omitempty"`
+	BookingURL      string   `json:"bookingUrl,omitempty"`
+	Setting         string   `json:"setting,omitempty"`         // indoor, outdoor or both
+	Accessibility   string   `json:"accessibility,omitempty"`   // Accessibility details, when mentioned
+	WeatherAdvisory string   `json:"weatherAdvisory,omitempty"` // Set on outdoor activities when bad weather is forecast
+	DistanceKm      *float64 `json:"distanceKm,omitempty"`      // From the search location, when both could be geocoded
 }
 
 // SearchResponse represents the response model for activity search
 type SearchResponse struct {
-	Success    bool       `json:"success"`
-	Activities []Activity `json:"activities,omitempty"`
-	Message    string     `json:"message,omitempty"`
-	Error      string     `json:"error,omitempty"`
+	Success       bool            `json:"success"`
+	Activities    []Activity      `json:"activities,omitempty"`
+	ShareURL      string          `json:"shareUrl,omitempty"`      // GET URL that repeats this search
+	NextPageToken string          `json:"nextPageToken,omitempty"` // Pass as pageToken to load more activities
+	SearchID      string          `json:"searchId,omitempty"`      // Refine these results with POST /v1/searches/{searchId}/refine
+	HolidayWindow *HolidayWindow  `json:"holidayWindow,omitempty"` // School holidays searched when no dates were given
+	Place         *Place          `json:"place,omitempty"`         // Canonical place the location was resolved to
+	Forecast      []DailyForecast `json:"forecast,omitempty"`      // Weather forecast for the searched place and dates
+	Facets        *SearchFacets   `json:"facets,omitempty"`        // Counts of the activities found, before filters
+	Message       string          `json:"message,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	ErrorCode     string          `json:"errorCode,omitempty"` // Machine-readable error, e.g. INVALID_REQUEST
+	Debug         *SearchDebug    `json:"debug,omitempty"`
+}
+
+// SearchDebug represents diagnostic details returned when requested
+type SearchDebug struct {
+	RequestID string                   `json:"requestId,omitempty"`
+	Usage     *TokenUsage              `json:"usage,omitempty"`
+	Scores    map[string]ActivityScore `json:"scores,omitempty"` // Ranking scores by activity ID
+}
+
+// Error codes returned in SearchResponse.ErrorCode
+const (
+	errorCodeInvalidRequest   = "INVALID_REQUEST"
+	errorCodeUnauthorized     = "UNAUTHORIZED"
+	errorCodeForbidden        = "FORBIDDEN"
+	errorCodeNotFound         = "NOT_FOUND"
+	errorCodeMethodNotAllowed = "METHOD_NOT_ALLOWED"
+	errorCodeRateLimited      = "RATE_LIMITED"
+	errorCodeBodyTooLarge     = "PAYLOAD_TOO_LARGE"
+	errorCodeUnsupportedMedia = "UNSUPPORTED_MEDIA_TYPE"
+	errorCodeInternal         = "INTERNAL_ERROR"
+	errorCodeUnavailable      = "UNAVAILABLE"
+	errorCodeUpstream         = "UPSTREAM_ERROR"
+	errorCodeBudgetExceeded   = "BUDGET_EXCEEDED"
+)
+
+// Lengths of the free-text fields of a search, which are copied into the prompt
+const (
+	maxQueryLength    = 200
+	maxLocationLength = 200
+)
+
+// validate checks that a search request can be turned into a prompt
+func (req *SearchRequest) validate() error {
+	if strings.TrimSpace(req.Query) == "" {
+		return fmt.Errorf("Query parameter is required and cannot be empty")
+	}
+	if len(req.Query) > maxQueryLength {
+		return fmt.Errorf("query must be at most %d characters", maxQueryLength)
+	}
+	if len(req.Location) > maxLocationLength {
+		return fmt.Errorf("location must be at most %d characters", maxLocationLength)
+	}
+	if req.AgeRange != nil && (req.AgeRange.Min < 0 || req.AgeRange.Min > req.AgeRange.Max) {
+		return fmt.Errorf("ageRange must have 0 <= min <= max")
+	}
+	if req.RadiusKm < 0 || req.RadiusKm > appConfig.Geo.MaxRadiusKm {
+		return fmt.Errorf("radiusKm must be between 0 and %g", appConfig.Geo.MaxRadiusKm)
+	}
+	if err := validSort(req.Sort); err != nil {
+		return err
+	}
+	if req.Filters != nil {
+		if err := req.Filters.validate(); err != nil {
+			return err
+		}
+	}
+	if req.PageSize < 0 || req.PageSize > appConfig.Search.MaxPageSize {
+		return fmt.Errorf("pageSize must be between 1 and %d", appConfig.Search.MaxPageSize)
+	}
+	if req.DateRange != nil {
+		start, err := time.Parse("2006-01-02", req.DateRange.StartDate)
+		if err != nil {
+			return fmt.Errorf("dateRange.startDate must be a date in yyyy-MM-dd format")
+		}
+		end, err := time.Parse("2006-01-02", req.DateRange.EndDate)
+		if err != nil {
+			return fmt.Errorf("dateRange.endDate must be a date in yyyy-MM-dd format")
+		}
+		if end.Before(start) {
+			return fmt.Errorf("dateRange.endDate must not be before dateRange.startDate")
+		}
+	}
+	return nil
 }
 
 // Rate limiting structures
@@ -67,10 +170,6 @@ type rateLimitEntry struct {
 var (
 	rateLimitMap = make(map[string]*rateLimitEntry)
 	rateLimitMux sync.Mutex
-
-	// Configuration
-	maxRequestsPerWindow = 20          // Max requests per IP
-	rateLimitWindow      = time.Minute // Time window
 )
 
 // getClientIP extracts the client IP from the request
@@ -90,7 +189,7 @@ func getClientIP(r *http.Request) string {
 }
 
 // checkRateLimit checks if the IP has exceeded rate limit
-func checkRateLimit(ip string) bool {
+func checkRateLimit(ctx context.Context, ip string) bool {
 	rateLimitMux.Lock()
 	defer rateLimitMux.Unlock()
 
@@ -101,13 +200,13 @@ func checkRateLimit(ip string) bool {
 		// Create new entry or reset expired one
 		rateLimitMap[ip] = &rateLimitEntry{
 			count:     1,
-			resetTime: now.Add(rateLimitWindow),
+			resetTime: now.Add(time.Duration(appConfig.RateLimit.Window)),
 		}
 		return true
 	}
 
-	if entry.count >= maxRequestsPerWindow {
-		log.Printf("Rate limit exceeded for IP: %s (%d requests)", ip, entry.count)
+	if entry.count >= appConfig.RateLimit.MaxRequests {
+		logger.WarnContext(ctx, "Rate limit exceeded", "ip", ip, "count", entry.count)
 		return false
 	}
 
@@ -128,115 +227,295 @@ func cleanupRateLimitMap() {
 	}
 }
 
-// SearchActivities is the HTTP Cloud Function entry point
+// SearchActivities is the HTTP Cloud Function entry point. It serves every route
+// in routes; POST or GET to "/" searches, as it always has.
 func SearchActivities(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	// Handle CORS preflight
-	if r.Method == http.MethodOptions {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		w.Header().Set("Access-Control-Max-Age", "3600")
-		w.WriteHeader(http.StatusNoContent)
-		return
-	}
-
-	// Set CORS headers for actual requests
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	router.ServeHTTP(w, r)
+}
 
-	// Only accept POST requests
-	if r.Method != http.MethodPost {
-		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed. Use POST.")
+// handleSearch searches for activities (GET /v1/search?q=... or POST /v1/search)
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	// Only accept GET (shareable query-string form) and POST (JSON body) requests
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed. Use GET or POST.")
 		return
 	}
 
-	// Get client IP for rate limiting
-	clientIP := getClientIP(r)
+	ctx := r.Context()
 
-	// Check rate limit
-	if !checkRateLimit(clientIP) {
-		sendErrorResponse(w, http.StatusTooManyRequests, "Rate limit exceeded. Please try again later.")
+	// Results are JSON, a calendar of the dated activities (ics) or a CSV or
+	// XLSX download of the activities
+	format, err := responseFormat(r, formatJSON, formatICS, formatCSV, formatXLSX)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// Parse request body
+	// Parse the query string (GET) or request body (POST)
 	var searchRequest SearchRequest
-	if err := json.NewDecoder(r.Body).Decode(&searchRequest); err != nil {
-		log.Printf("Invalid JSON: %v", err)
-		sendErrorResponse(w, http.StatusBadRequest, "Invalid JSON format")
-		return
+	if r.Method == http.MethodGet {
+		searchRequest, err = searchRequestFromQuery(r.URL.Query())
+		if err != nil {
+			logger.WarnContext(ctx, "Invalid query parameters", "error", err)
+			sendErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else {
+		if status, err := decodeJSONBody(w, r, &searchRequest); err != nil {
+			logger.WarnContext(ctx, "Invalid request body", "error", err)
+			sendErrorResponse(w, status, err.Error())
+			return
+		}
 	}
-	defer r.Body.Close()
 
 	// Log the complete request details
 	bodyJSON, _ := json.Marshal(searchRequest)
-	log.Printf("Incoming request - Method: %s, URL: %s, Query: %s, Body: %s",
-		r.Method, r.URL.Path, r.URL.RawQuery, string(bodyJSON))
+	logger.DebugContext(ctx, "Incoming request",
+		"method", r.Method, "path", r.URL.Path, "body", string(bodyJSON))
 
 	// Validate request
-	if strings.TrimSpace(searchRequest.Query) == "" {
-		sendErrorResponse(w, http.StatusBadRequest, "Query parameter is required and cannot be empty")
+	if err := searchRequest.validate(); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Resolve the location to a canonical place, then without dates, search
+	// the next school holidays there
+	share := shareURL(&searchRequest)
+	if err := searchRequest.resolvePlace(ctx); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	window, err := searchRequest.resolveHolidayWindow(time.Now())
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if window != nil {
+		logger.InfoContext(ctx, "Resolved school holidays", "region", window.Region, "holidays", window.Name,
+			"startDate", window.StartDate, "endDate", window.EndDate)
+	}
+
+	// Continue a paginated search from where the previous page stopped
+	var sessionID string
+	if searchRequest.PageToken != "" {
+		var err error
+		if sessionID, err = searchSessions.resume(searchRequest.PageToken, &searchRequest); err != nil {
+			logger.WarnContext(ctx, "Invalid page token", "error", err)
+			sendErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	// Refuse new searches once the daily token budget is used up
+	if err := dailyBudgetError(); err != nil {
+		sendSearchError(ctx, w, err)
 		return
 	}
 
 	// Process search query
-	log.Printf("Processing search query: %s", searchRequest.Query)
-	activities := performSearch(&searchRequest)
+	logger.InfoContext(ctx, "Processing search query", "query", searchRequest.Query)
+	ctx = withGroundingCollector(withUsageTracker(ctx))
+	activities, err := performSearch(ctx, &searchRequest)
+	if err != nil {
+		sendSearchError(ctx, w, err)
+		return
+	}
 
-	// Send success response
-	response := SearchResponse{
-		Success:    true,
-		Activities: activities,
-		Message:    fmt.Sprintf("Found %d activities", len(activities)),
+	// Drop activities earlier pages already returned and remember this page
+	var nextPageToken string
+	page := func(activities []Activity) []Activity {
+		if searchRequest.paginated() {
+			activities, nextPageToken = searchSessions.record(sessionID, &searchRequest, activities)
+		}
+		return activities
+	}
+	response := searchResponse(ctx, &searchRequest, activities, page)
+	activities = response.Activities
+	response.ShareURL = share
+	response.NextPageToken = nextPageToken
+
+	// A POST search starts a conversation the client can refine. GET responses
+	// are cached and shared, so they don't carry a search ID.
+	if r.Method == http.MethodPost && !searchRequest.paginated() {
+		response.SearchID = conversations.start(&searchRequest, activities)
+	}
+
+	// GET results are cacheable so they can be shared and served by a CDN.
+	// Empty results may fill in on a retry, and paginated results hold a page
+	// token tied to this instance, so neither is cached.
+	maxAge := time.Duration(appConfig.Search.CacheMaxAge)
+	if r.Method != http.MethodGet || len(activities) == 0 || searchRequest.paginated() {
+		maxAge = 0
+	}
+
+	switch {
+	case format == formatICS:
+		// A GET search URL with format=ics is a calendar feed apps can subscribe to
+		writeCalendarResponse(w, r, "School holiday activities: "+searchRequest.Query, "activities.ics",
+			activityEvents(ctx, activities), maxAge)
+		return
+	case format == formatCSV || format == formatXLSX:
+		writeExportResponse(w, r, format, activities, maxAge)
+		return
+	case r.Method == http.MethodGet:
+		writeCacheableJSON(w, r, response, maxAge)
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
 
-// performSearch searches for activities based on the query using Gemini API
-func performSearch(req *SearchRequest) []Activity {
-	log.Printf("Searching with query: '%s'", req.Query)
+// searchResponse counts facets over the activities a search found, filters and
+// ranks them and builds the response shared by searches and refinements. page,
+// when set, cuts the filtered activities down to the page being returned.
+func searchResponse(ctx context.Context, req *SearchRequest, activities []Activity, page func([]Activity) []Activity) SearchResponse {
+	facets := searchFacets(activities)
+	activities = req.Filters.apply(activities)
+	if page != nil {
+		activities = page(activities)
+	}
+	scores := rankActivities(ctx, activities, req)
+	metrics.recordActivitiesReturned(ctx, len(activities))
+	usage := logSearchUsage(ctx)
+
+	response := SearchResponse{
+		Success:       true,
+		Activities:    activities,
+		HolidayWindow: req.holiday,
+		Place:         req.place,
+		Forecast:      req.forecast,
+		Facets:        facets,
+		Message:       fmt.Sprintf("Found %d activities", len(activities)),
+	}
+	if req.Debug && appConfig.Debug.Endpoints {
+		response.Debug = &SearchDebug{
+			RequestID: requestIDFromContext(ctx),
+			Usage:     &usage,
+			Scores:    scores,
+		}
+	}
+	return response
+}
+
+// logSearchUsage logs the tokens a search used and returns them
+func logSearchUsage(ctx context.Context) TokenUsage {
+	usage := usageFromContext(ctx)
+	logger.InfoContext(ctx, "Search token usage",
+		"calls", usage.Calls,
+		"promptTokens", usage.PromptTokens,
+		"candidatesTokens", usage.CandidatesTokens,
+		"toolUsePromptTokens", usage.ToolUsePromptTokens,
+		"totalTokens", usage.TotalTokens,
+		"estimatedCostUsd", usage.EstimatedCostUSD)
+	return usage
+}
+
+// performSearch searches for activities based on the query using Gemini API.
+// An error means the search failed, as opposed to finding no activities.
+func performSearch(ctx context.Context, req *SearchRequest) ([]Activity, error) {
+	logger.DebugContext(ctx, "Searching", "query", req.Query)
 
 	if req.Location != "" {
-		log.Printf("Location filter: %s", req.Location)
+		logger.DebugContext(ctx, "Location filter", "location", req.Location)
 	}
 	if req.AgeRange != nil {
-		log.Printf("Age range filter: %d-%d", req.AgeRange.Min, req.AgeRange.Max)
+		logger.DebugContext(ctx, "Age range filter", "min", req.AgeRange.Min, "max", req.AgeRange.Max)
 	}
 	if req.DateRange != nil {
-		log.Printf("Date range filter: %s to %s", req.DateRange.StartDate, req.DateRange.EndDate)
+		logger.DebugContext(ctx, "Date range filter", "startDate", req.DateRange.StartDate, "endDate", req.DateRange.EndDate)
 	}
 
 	// Create Gemini client and query for activity suggestions
-	geminiClient := NewGeminiClient()
-	activities, err := geminiClient.GenerateActivitiesSuggestions(req)
+	geminiClient := NewGeminiClient(ctx)
+	activities, err := geminiClient.GenerateActivitiesSuggestions(ctx, req)
 
 	if err != nil {
-		log.Printf("Error querying Gemini API: %v", err)
-		// TODO: Add proper exception handling/recovery mechanism to capture and handle errors gracefully
-		// Return empty list instead of irrelevant fallback activities
-		return []Activity{}
+		return nil, fmt.Errorf("failed to query Gemini API: %w", err)
 	}
 
-	return activities
+	// Gemini doesn't always respect the dates in the prompt
+	activities = filterByDateRange(activities, req.DateRange)
+
+	// Keep the activities so GET /v1/activities/{id} can return them later
+	if err := activityStore.Put(ctx, activities); err != nil {
+		logger.ErrorContext(ctx, "Failed to store activities", "error", err)
+	}
+
+	// Distances and weather depend on the search, so they are added after storing
+	activities = applyDistances(ctx, activities, req)
+	req.resolveForecast(ctx)
+	applyWeather(activities, req)
+
+	return activities, nil
+}
+
+// sendSearchError reports a search that failed, so clients can tell it from a
+// search that found nothing. A used-up token budget is reported as such.
+func sendSearchError(ctx context.Context, w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrTokenBudgetExceeded) {
+		logger.WarnContext(ctx, "Search stopped by token budget", "error", err)
+		sendErrorResponseWithCode(w, http.StatusServiceUnavailable, errorCodeBudgetExceeded,
+			"Search is temporarily unavailable. Please try again later.")
+		return
+	}
+	logger.ErrorContext(ctx, "Search failed", "error", err)
+	sendErrorResponse(w, http.StatusBadGateway, "Search failed. Please try again later.")
 }
 
 // sendErrorResponse sends an error response with the given status code and message
 func sendErrorResponse(w http.ResponseWriter, statusCode int, errorMessage string) {
+	sendErrorResponseWithCode(w, statusCode, errorCodeForStatus(statusCode), errorMessage)
+}
+
+// sendErrorResponseWithCode sends an error response with an error code more
+// specific than the status code's
+func sendErrorResponseWithCode(w http.ResponseWriter, statusCode int, errorCode, errorMessage string) {
 	response := SearchResponse{
-		Success: false,
-		Error:   errorMessage,
+		Success:   false,
+		Error:     errorMessage,
+		ErrorCode: errorCode,
 	}
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(response)
 }
 
+// errorCodeForStatus maps an HTTP status code to the error code reported to clients
+func errorCodeForStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return errorCodeInvalidRequest
+	case http.StatusUnauthorized:
+		return errorCodeUnauthorized
+	case http.StatusForbidden:
+		return errorCodeForbidden
+	case http.StatusNotFound:
+		return errorCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return errorCodeMethodNotAllowed
+	case http.StatusTooManyRequests:
+		return errorCodeRateLimited
+	case http.StatusRequestEntityTooLarge:
+		return errorCodeBodyTooLarge
+	case http.StatusUnsupportedMediaType:
+		return errorCodeUnsupportedMedia
+	case http.StatusBadGateway:
+		return errorCodeUpstream
+	case http.StatusServiceUnavailable:
+		return errorCodeUnavailable
+	default:
+		if statusCode >= http.StatusInternalServerError {
+			return errorCodeInternal
+		}
+		return errorCodeInvalidRequest
+	}
+}
+
 // init starts background cleanup of rate limit map
 func init() {
 	go func() {
-		ticker := time.NewTicker(10 * time.Minute)
+		ticker := time.NewTicker(time.Duration(appConfig.RateLimit.CleanupInterval))
 		for range ticker.C {
 			cleanupRateLimitMap()
 		}
@@ -6,14 +6,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
-	"os"
 	"strings"
 	"time"
+	"unicode"
 
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	secretmanagerpb "cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // GeminiRequest represents the request structure for Gemini API
@@ -38,9 +39,16 @@ type GoogleSearchTool struct{}
 
 // Content represents the content structure in Gemini request
 type Content struct {
+	Role  string `json:"role,omitempty"` // user or model; needed when Contents holds several turns
 	Parts []Part `json:"parts"`
 }
 
+// Roles of the turns in a multi-turn Gemini request
+const (
+	roleUser  = "user"
+	roleModel = "model"
+)
+
 // Part represents a part of the content (text or other media)
 type Part struct {
 	Text string `json:"text"`
@@ -48,7 +56,8 @@ type Part struct {
 
 // GeminiResponse represents the response from Gemini API
 type GeminiResponse struct {
-	Candidates []Candidate `json:"candidates"`
+	Candidates    []Candidate    `json:"candidates"`
+	UsageMetadata *UsageMetadata `json:"usageMetadata,omitempty"`
 }
 
 // Candidate represents a candidate response from Gemini
@@ -72,7 +81,8 @@ type SafetyRating struct {
 
 // GroundingMetadata represents grounding metadata from Gemini response
 type GroundingMetadata struct {
-	GroundingChunks []GroundingChunk `json:"groundingChunks,omitempty"`
+	GroundingChunks   []GroundingChunk   `json:"groundingChunks,omitempty"`
+	GroundingSupports []GroundingSupport `json:"groundingSupports,omitempty"`
 }
 
 // GroundingChunk represents a single grounding chunk
@@ -88,20 +98,27 @@ type WebChunk struct {
 
 // GeminiClient handles communication with the Gemini API
 type GeminiClient struct {
-	APIKey string
-	Model  string
+	APIKey  string
+	Model   string
+	BaseURL string // e.g. https://generativelanguage.googleapis.com/v1beta
 }
 
 // getSecretValue retrieves a secret value from Google Cloud Secret Manager
-func getSecretValue(ctx context.Context, projectID, secretName string) (string, error) {
+func getSecretValue(ctx context.Context, projectID, secretName, version string) (value string, err error) {
+	ctx, span := tracer.Start(ctx, "getSecretValue", trace.WithAttributes(
+		attribute.String("secret.name", secretName),
+		attribute.String("secret.version", version),
+	))
+	defer func() { endSpan(span, err) }()
+
 	client, err := secretmanager.NewClient(ctx)
 	if err != nil {
 		return "", fmt.Errorf("failed to create secret manager client: %w", err)
 	}
 	defer client.Close()
 
-	// Build the resource name: projects/{project}/secrets/{secret}/versions/latest
-	name := fmt.Sprintf("projects/%s/secrets/%s/versions/latest", projectID, secretName)
+	// Build the resource name: projects/{project}/secrets/{secret}/versions/{version}
+	name := fmt.Sprintf("projects/%s/secrets/%s/versions/%s", projectID, secretName, version)
 
 	// Access the secret version
 	req := &secretmanagerpb.AccessSecretVersionRequest{
@@ -116,32 +133,22 @@ func getSecretValue(ctx context.Context, projectID, secretName string) (string,
 	return string(result.Payload.Data), nil
 }
 
-// NewGeminiClient creates a new Gemini API client
-func NewGeminiClient() *GeminiClient {
-	ctx := context.Background()
-	projectID := os.Getenv("GOOGLE_CLOUD_PROJECT") // Cloud Functions Gen2 sets this automatically
-
-	var apiKey string
-	var err error
-
-	// Fetch from Secret Manager only
-	if projectID != "" {
-		log.Printf("Using project ID: %s", projectID)
-		apiKey, err = getSecretValue(ctx, projectID, "gemini-api-key")
-		if err != nil {
-			log.Printf("Error: Failed to fetch API key from Secret Manager: %v", err)
-		}
-	} else {
-		log.Println("Error: No GCP project ID found in environment (GOOGLE_CLOUD_PROJECT or GCP_PROJECT_ID)")
-	}
+// NewGeminiClient creates a new Gemini API client using the default credential chain
+func NewGeminiClient(ctx context.Context) *GeminiClient {
+	return NewGeminiClientWithCredentials(ctx, defaultCredentials)
+}
 
-	if apiKey == "" {
-		log.Println("Warning: GEMINI_API_KEY not found in Secret Manager")
+// NewGeminiClientWithCredentials creates a new Gemini API client with the key from the given provider
+func NewGeminiClientWithCredentials(ctx context.Context, credentials CredentialProvider) *GeminiClient {
+	apiKey, err := credentials.APIKey(ctx)
+	if err != nil {
+		logger.ErrorContext(ctx, "Gemini API key unavailable", "error", err)
 	}
 
 	return &GeminiClient{
-		APIKey: apiKey,
-		Model:  "gemini-2.0-flash",
+		APIKey:  apiKey,
+		Model:   appConfig.Gemini.Model,
+		BaseURL: strings.TrimSuffix(appConfig.Gemini.BaseURL, "/"),
 	}
 }
 
@@ -149,13 +156,15 @@ func NewGeminiClient() *GeminiClient {
 // This uses a two-stage approach:
 // 1. Search mode with Google Search to find activities with valid URLs
 // 2. JSON conversion to structure the results properly
-func (c *GeminiClient) GenerateActivitiesSuggestions(req *SearchRequest) ([]Activity, error) {
+func (c *GeminiClient) GenerateActivitiesSuggestions(ctx context.Context, req *SearchRequest) ([]Activity, error) {
 	if c.APIKey == "" {
 		return nil, fmt.Errorf("Gemini API key not configured")
 	}
 
 	// Stage 1: Search mode with Google Search
-	searchResults, err := c.searchWithGoogleSearch(req)
+	stageStart := time.Now()
+	searchResults, err := c.searchWithGoogleSearch(ctx, req)
+	metrics.recordStage(ctx, stageSearch, stageStart)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search for activities: %w", err)
 	}
@@ -164,10 +173,10 @@ func (c *GeminiClient) GenerateActivitiesSuggestions(req *SearchRequest) ([]Acti
 		return nil, fmt.Errorf("empty search results from Stage 1")
 	}
 
-	log.Printf("Search results from Stage 1: %s", searchResults)
+	logger.DebugContext(ctx, "Search results from Stage 1", "searchResults", searchResults)
 
 	// Stage 2: Convert search results to structured JSON
-	activities, err := c.convertToStructuredJSON(searchResults, req)
+	activities, err := c.convertToStructuredJSON(ctx, searchResults, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to convert to structured JSON: %w", err)
 	}
@@ -176,11 +185,19 @@ func (c *GeminiClient) GenerateActivitiesSuggestions(req *SearchRequest) ([]Acti
 }
 
 // searchWithGoogleSearch performs Stage 1: Search mode with Google Search
-func (c *GeminiClient) searchWithGoogleSearch(req *SearchRequest) (string, error) {
-	// Build the search prompt
-	searchPrompt := c.buildSearchPrompt(req)
+func (c *GeminiClient) searchWithGoogleSearch(ctx context.Context, req *SearchRequest) (results string, err error) {
+	ctx, span := tracer.Start(ctx, "searchWithGoogleSearch")
+	defer func() { endSpan(span, err) }()
+
+	// Build the search prompt; a refinement continues the conversation of an
+	// earlier search instead
+	searchPrompt := req.refinement
+	if searchPrompt == "" {
+		searchPrompt = c.buildSearchPrompt(req)
+	}
+	span.SetAttributes(attribute.Int("prompt.size", len(searchPrompt)))
 
-	log.Printf("Stage 1 Search Prompt: %s", searchPrompt)
+	logger.DebugContext(ctx, "Stage 1 search prompt", "prompt", searchPrompt)
 
 	// Create the Gemini API request with Google Search tool
 	geminiReq := GeminiRequest{
@@ -191,13 +208,12 @@ func (c *GeminiClient) searchWithGoogleSearch(req *SearchRequest) (string, error
 				},
 			},
 		},
-		Contents: []Content{
-			{
-				Parts: []Part{
-					{Text: searchPrompt},
-				},
+		Contents: append(append([]Content(nil), req.history...), Content{
+			Role: roleUser,
+			Parts: []Part{
+				{Text: searchPrompt},
 			},
-		},
+		}),
 		Tools: []Tool{
 			{
 				GoogleSearch: &GoogleSearchTool{},
@@ -206,20 +222,35 @@ func (c *GeminiClient) searchWithGoogleSearch(req *SearchRequest) (string, error
 	}
 
 	// Send request to Gemini
-	responseText, err := c.sendGeminiRequest(geminiReq)
+	responseText, err := c.sendGeminiRequest(ctx, geminiReq)
 	if err != nil {
 		return "", err
 	}
 
+	// Keep both turns so the search can be refined later
+	req.history = append(geminiReq.Contents, Content{
+		Role:  roleModel,
+		Parts: []Part{{Text: responseText}},
+	})
+
 	return responseText, nil
 }
 
 // convertToStructuredJSON performs Stage 2: Convert search results to structured JSON
-func (c *GeminiClient) convertToStructuredJSON(searchResults string, req *SearchRequest) ([]Activity, error) {
+func (c *GeminiClient) convertToStructuredJSON(ctx context.Context, searchResults string, req *SearchRequest) (activities []Activity, err error) {
+	ctx, span := tracer.Start(ctx, "convertToStructuredJSON")
+	defer func() {
+		span.SetAttributes(attribute.Int("activities.count", len(activities)))
+		endSpan(span, err)
+	}()
+
+	stageStart := time.Now()
+
 	// Build the conversion prompt
 	conversionPrompt := c.buildConversionPrompt(searchResults, req)
+	span.SetAttributes(attribute.Int("prompt.size", len(conversionPrompt)))
 
-	log.Printf("Stage 2 Conversion Prompt: %s", conversionPrompt)
+	logger.DebugContext(ctx, "Stage 2 conversion prompt", "prompt", conversionPrompt)
 
 	// Create the Gemini API request without tools
 	geminiReq := GeminiRequest{
@@ -240,15 +271,14 @@ func (c *GeminiClient) convertToStructuredJSON(searchResults string, req *Search
 	}
 
 	// Send request to Gemini
-	responseText, err := c.sendGeminiRequest(geminiReq)
+	responseText, err := c.sendGeminiRequest(ctx, geminiReq)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Printf("Stage 2 JSON conversion response: %s", responseText)
+	logger.DebugContext(ctx, "Stage 2 JSON conversion response", "response", responseText)
 
 	// Parse the JSON response
-	var activities []Activity
 	if err := json.Unmarshal([]byte(responseText), &activities); err != nil {
 		// If direct parsing fails, try to extract JSON from markdown code blocks
 		activities, err = c.extractJSONFromMarkdown(responseText)
@@ -257,42 +287,80 @@ func (c *GeminiClient) convertToStructuredJSON(searchResults string, req *Search
 		}
 	}
 
-	log.Printf("Parsed activities: %+v", activities)
+	// Map free-text categories and settings onto the controlled values
+	normalizeCategories(activities)
+	for i := range activities {
+		activities[i].Setting = normalizeSetting(activities[i].Setting)
+		activities[i].Setting = inferSetting(activities[i])
+	}
+
+	logger.InfoContext(ctx, "Parsed activities", "count", len(activities))
+	logger.DebugContext(ctx, "Parsed activity details", "activities", activities)
 
 	// Post-process to extract URLs if missing
-	activities = c.postProcessURLs(activities, searchResults)
+	activities = c.postProcessURLs(ctx, activities, searchResults)
+
+	// Merge duplicates before Stage 3 so no recovery request is spent on them
+	if deduped := dedupeActivities(activities); len(deduped) < len(activities) {
+		logger.InfoContext(ctx, "Merged duplicate activities", "before", len(activities), "after", len(deduped))
+		activities = deduped
+	}
+	metrics.recordStage(ctx, stageConvert, stageStart)
+
+	// Stage 3: Recover missing URLs (limited by search.urlRecoveryLimit)
+	stageStart = time.Now()
+	activities = c.recoverMissingURLs(ctx, activities)
+	metrics.recordStage(ctx, stageRecovery, stageStart)
 
-	// Stage 3: Recover missing URLs (max 2 recovery requests)
-	activities = c.recoverMissingURLs(activities)
+	assignActivityIDs(activities)
 
 	return activities, nil
 }
 
 // sendGeminiRequest sends a request to Gemini API and returns the response text
-func (c *GeminiClient) sendGeminiRequest(geminiReq GeminiRequest) (string, error) {
+func (c *GeminiClient) sendGeminiRequest(ctx context.Context, geminiReq GeminiRequest) (text string, err error) {
+	ctx, span := tracer.Start(ctx, "sendGeminiRequest",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("gen_ai.system", "gemini"),
+			attribute.String("gen_ai.request.model", c.Model),
+			attribute.Bool("gemini.google_search", len(geminiReq.Tools) > 0),
+		),
+	)
+	defer func() { endSpan(span, err) }()
+
 	// Marshal request to JSON
 	jsonData, err := json.Marshal(geminiReq)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
+	span.SetAttributes(attribute.Int("prompt.size", len(jsonData)))
+
+	// In abort mode, stop before spending more tokens than the budget allows
+	if appConfig.Budget.Action == budgetActionAbort {
+		if err := tokenBudgetError(ctx); err != nil {
+			return "", err
+		}
+	}
 
-	log.Printf("Gemini request: %s", string(jsonData))
+	logger.DebugContext(ctx, "Gemini request", "body", string(jsonData))
 
-	// Build the API URL
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s",
-		c.Model, c.APIKey)
+	// Build the API URL. The key is sent in a header so it never appears in URLs or error strings.
+	url := fmt.Sprintf("%s/models/%s:generateContent", c.BaseURL, c.Model)
 
 	// Create HTTP request
-	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("x-goog-api-key", c.APIKey)
 
 	// Send request
 	client := &http.Client{}
 	resp, err := client.Do(httpReq)
 	if err != nil {
+		metrics.recordGeminiCall(ctx, 0, true)
 		return "", fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
@@ -300,15 +368,21 @@ func (c *GeminiClient) sendGeminiRequest(geminiReq GeminiRequest) (string, error
 	// Read response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
+		metrics.recordGeminiCall(ctx, resp.StatusCode, true)
 		return "", fmt.Errorf("failed to read response: %w", err)
 	}
 
 	// Check for non-200 status codes
+	metrics.recordGeminiCall(ctx, resp.StatusCode, resp.StatusCode != http.StatusOK)
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			invalidateCredentials(c.APIKey)
+		}
 		return "", fmt.Errorf("Gemini API error (status %d): %s", resp.StatusCode, string(body))
 	}
 
-	log.Printf("Gemini response body: %s", string(body))
+	logger.DebugContext(ctx, "Gemini response", "body", string(body))
 
 	// Parse response
 	var geminiResp GeminiResponse
@@ -316,25 +390,39 @@ func (c *GeminiClient) sendGeminiRequest(geminiReq GeminiRequest) (string, error
 		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
 
+	// Account for the tokens used by this call
+	if geminiResp.UsageMetadata != nil {
+		recordTokenUsage(ctx, *geminiResp.UsageMetadata)
+		span.SetAttributes(
+			attribute.Int("gen_ai.usage.input_tokens", geminiResp.UsageMetadata.PromptTokenCount),
+			attribute.Int("gen_ai.usage.output_tokens", geminiResp.UsageMetadata.CandidatesTokenCount),
+		)
+	}
+
 	// Check if we have any candidates in the response
 	if len(geminiResp.Candidates) == 0 {
-		log.Printf("Warning: No candidates returned from Gemini API")
+		logger.WarnContext(ctx, "No candidates returned from Gemini API")
 		return "", fmt.Errorf("no candidates in Gemini response")
 	}
 
 	candidate := geminiResp.Candidates[0]
+	span.SetAttributes(attribute.String("gen_ai.response.finish_reason", candidate.FinishReason))
+	if candidate.GroundingMetadata != nil {
+		span.SetAttributes(attribute.Int("gemini.grounding_chunks", len(candidate.GroundingMetadata.GroundingChunks)))
+		recordGrounding(ctx, candidate.GroundingMetadata)
+	}
 
 	// Log the finish reason to help diagnose incomplete responses
 	if candidate.FinishReason != "" {
-		log.Printf("Gemini finish reason: %s", candidate.FinishReason)
+		logger.InfoContext(ctx, "Gemini finish reason", "finishReason", candidate.FinishReason)
 	}
 
 	// Extract URLs from grounding metadata if available
 	if candidate.GroundingMetadata != nil && len(candidate.GroundingMetadata.GroundingChunks) > 0 {
-		log.Printf("Stage 1: Found %d grounding chunks in metadata", len(candidate.GroundingMetadata.GroundingChunks))
-		groundingURLs := c.extractURLsFromGroundingMetadata(candidate.GroundingMetadata)
+		logger.InfoContext(ctx, "Stage 1: Found grounding chunks in metadata", "count", len(candidate.GroundingMetadata.GroundingChunks))
+		groundingURLs := c.extractURLsFromGroundingMetadata(ctx, candidate.GroundingMetadata)
 		if len(groundingURLs) > 0 {
-			log.Printf("Stage 1: Extracted %d URLs from grounding metadata: %v", len(groundingURLs), groundingURLs)
+			logger.DebugContext(ctx, "Stage 1: Extracted URLs from grounding metadata", "count", len(groundingURLs), "urls", groundingURLs)
 		}
 	}
 
@@ -351,39 +439,109 @@ func (c *GeminiClient) sendGeminiRequest(geminiReq GeminiRequest) (string, error
 	fullText := strings.Join(texts, "")
 
 	if fullText == "" {
-		log.Printf("Warning: Empty response text from Gemini. Finish reason: %s, Number of parts: %d", candidate.FinishReason, len(candidate.Content.Parts))
+		logger.WarnContext(ctx, "Empty response text from Gemini", "finishReason", candidate.FinishReason, "parts", len(candidate.Content.Parts))
 		return "", fmt.Errorf("empty response text from Gemini (finish reason: %s)", candidate.FinishReason)
 	}
 
 	// Inject grounding URLs into the response text if they're missing
 	if candidate.GroundingMetadata != nil && len(candidate.GroundingMetadata.GroundingChunks) > 0 {
-		fullText = c.injectGroundingURLsIntoText(fullText, candidate.GroundingMetadata)
+		fullText = c.injectGroundingURLsIntoText(ctx, fullText, candidate.GroundingMetadata)
 	}
 
 	return fullText, nil
 }
 
+// getModel calls models.get for the configured model. It is a cheap way to check
+// that the API is reachable and accepts the key, without spending tokens.
+func (c *GeminiClient) getModel(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "getModel",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("gen_ai.request.model", c.Model)),
+	)
+	defer func() { endSpan(span, err) }()
+
+	url := fmt.Sprintf("%s/models/%s", c.BaseURL, c.Model)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("x-goog-api-key", c.APIKey)
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+			invalidateCredentials(c.APIKey)
+		}
+		return fmt.Errorf("Gemini API error (status %d)", resp.StatusCode)
+	}
+	return nil
+}
+
 // buildSearchPrompt constructs the search prompt for Stage 1 (Google Search mode)
 func (c *GeminiClient) buildSearchPrompt(req *SearchRequest) string {
-	// Build the main search query
-	prompt := fmt.Sprintf("Search for 5-10 %s activities", req.Query)
+	// Build the main search query; a paginated search asks for exactly one page
+	var prompt string
+	if req.PageSize > 0 {
+		prompt = fmt.Sprintf("Search for %d %s activities", req.PageSize, promptText(req.Query))
+	} else {
+		prompt = fmt.Sprintf("Search for %d-%d %s activities", appConfig.Search.MinResults, appConfig.Search.MaxResults, promptText(req.Query))
+	}
 
 	if req.AgeRange != nil {
 		prompt += fmt.Sprintf(" for kids aged %d-%d", req.AgeRange.Min, req.AgeRange.Max)
 	}
 
-	if req.Location != "" {
-		prompt += fmt.Sprintf(" in %s", req.Location)
+	if location := promptText(req.Location); location != "" && req.RadiusKm > 0 {
+		prompt += fmt.Sprintf(" within %g km of %s", req.RadiusKm, location)
+	} else if location != "" {
+		prompt += fmt.Sprintf(" in %s", location)
 	}
 
-	// Determine the year to use in the search
-	var searchYear string
-	if req.DateRange != nil {
-		searchYear = req.DateRange.StartDate[:4] // Extract year from date range
-	} else {
-		searchYear = fmt.Sprintf("%d", time.Now().Year()) // Use current year
+	// Name the school holidays the dates were resolved to, otherwise give the
+	// requested dates, otherwise the current year
+	switch {
+	case req.holiday != nil:
+		prompt += fmt.Sprintf(" during the %s %s (%s to %s) and list the prices.\n\n",
+			req.holiday.RegionName, strings.ToLower(req.holiday.Name), req.holiday.StartDate, req.holiday.EndDate)
+	case req.DateRange != nil:
+		prompt += fmt.Sprintf(" for school holidays between %s and %s and list the prices.\n\n", req.DateRange.StartDate, req.DateRange.EndDate)
+	default:
+		prompt += fmt.Sprintf(" for school holidays in %d and list the prices.\n\n", time.Now().Year())
+	}
+
+	// Later pages must find activities the earlier pages didn't return
+	if len(req.excludeTitles) > 0 {
+		prompt += "Only include activities that are NOT in this list of activities already found:\n"
+		for _, title := range req.excludeTitles {
+			prompt += fmt.Sprintf("- %s\n", promptText(title))
+		}
+		prompt += "\n"
+	}
+
+	// Narrow the search to the requested filters
+	if f := req.Filters; !f.empty() {
+		if len(f.Categories) > 0 {
+			prompt += fmt.Sprintf("Only include %s activities.\n", strings.Join(f.Categories, " or "))
+		}
+		if f.FreeOnly {
+			prompt += "Only include free activities.\n"
+		} else if f.MaxPrice != nil {
+			prompt += fmt.Sprintf("Only include activities costing $%g or less.\n", *f.MaxPrice)
+		}
+		if f.Setting != "" {
+			prompt += fmt.Sprintf("Only include %s activities.\n", f.Setting)
+		}
+		if f.Accessible {
+			prompt += "Only include activities with wheelchair or other accessibility support.\n"
+		}
+		prompt += "\n"
 	}
-	prompt += fmt.Sprintf(" for school holidays in %s and list the prices.\n\n", searchYear)
 
 	// Add critical instructions - simplified and focused
 	prompt += `### CRITICAL INSTRUCTIONS FOR URLS:
@@ -396,11 +554,23 @@ func (c *GeminiClient) buildSearchPrompt(req *SearchRequest) string {
    - URL: [Direct Web Link]
    - Category: [Category type if available]
    - Location: [Specific venue/location name if available]
-   - Price: [Price if available]`
+   - Date: [Date and start/end times if available]
+   - Price: [Price if available]
+   - Setting: [Indoor, Outdoor or Both if known]
+   - Accessibility: [Accessibility details if mentioned]`
 
 	return prompt
 }
 
+// promptText makes client text safe to embed in a prompt line: invalid UTF-8 is
+// dropped and line breaks, control characters and runs of spaces become one
+// space, so the text can't start new instructions of its own
+func promptText(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToValidUTF8(text, ""), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}), " ")
+}
+
 // buildConversionPrompt constructs the conversion prompt for Stage 2 (JSON formatting)
 func (c *GeminiClient) buildConversionPrompt(searchResults string, req *SearchRequest) string {
 	prompt := fmt.Sprintf(`Convert the following activity search results into a JSON array. DO NOT perform any new searches, generate new activities, or modify any information. Only parse and reformat the exact data provided in the Search Results section below into the specified JSON structure. Preserve all URLs exactly as they appear in the search results.
@@ -414,13 +584,17 @@ Please respond with ONLY a JSON array of activities in the following format (no
     "id": "unique-id",
     "title": "Activity Title",
     "description": "Brief description of the activity",
-    "category": "Category (e.g., Educational, Sports, Arts, Outdoor)",
+    "category": "Exactly one category from the list below",
     "location": "Location name",
     "ageRange": "Age range (e.g., 6-12 years)",
     "date": "Date in yyyy-MM-dd format or empty string if not available",
+    "startTime": "Start time in HH:mm 24-hour format or empty string if not available",
+    "endTime": "End time in HH:mm 24-hour format or empty string if not available",
     "price": "Price (e.g., Free, $20, $10-$30) or empty string if not available",
     "imageUrl": "https://example.com/image.jpg or empty string if not available",
-    "bookingUrl": "[Extracted URL from search results] - MUST be the exact URL from the Search Results above"
+    "bookingUrl": "[Extracted URL from search results] - MUST be the exact URL from the Search Results above",
+    "setting": "indoor, outdoor, both or empty string if not available",
+    "accessibility": "Accessibility details (e.g., Wheelchair accessible) or empty string if not mentioned"
   }
 ]
 
@@ -436,15 +610,15 @@ CRITICAL REQUIREMENTS FOR URL EXTRACTION:
 - If no URL is found for an activity, use an empty string ""
 
 OTHER REQUIREMENTS:
-- Generate a unique ID for each activity (e.g., "activity-1", "activity-2")
-- Category: Extract from the search results only (Educational, Sports, Arts, Outdoor, Entertainment, Technology, Science, etc.)
+- Generate a unique ID for each activity (e.g., "activity-1", "activity-2"); it is replaced by a stable ID afterwards
+- Category: Choose exactly one of %s, based on the search results only
 - Location: Extract the specific venue/location name from the search results only
 - Price: Extract price information from the search results only (e.g., "Free", "$25", "$15-$30", "From $20")
 - If date is not available in search results, use an empty string ""
 - If price is not mentioned in search results, use an empty string ""
 - If imageUrl is not available, use an empty string ""
 - Ensure all JSON is valid and properly formatted
-- DO NOT add, remove, or invent any information not present in the Search Results`, searchResults)
+- DO NOT add, remove, or invent any information not present in the Search Results`, searchResults, strings.Join(activityCategories, ", "))
 
 	return prompt
 }
@@ -496,18 +670,18 @@ func (c *GeminiClient) extractJSONFromMarkdown(text string) ([]Activity, error)
 }
 
 // postProcessURLs extracts URLs from search results if bookingUrl is missing
-func (c *GeminiClient) postProcessURLs(activities []Activity, searchResults string) []Activity {
+func (c *GeminiClient) postProcessURLs(ctx context.Context, activities []Activity, searchResults string) []Activity {
 	// Extract all URLs from search results
 	urls := c.extractURLsFromText(searchResults)
 
-	log.Printf("Extracted URLs from search results: %v", urls)
+	logger.DebugContext(ctx, "Extracted URLs from search results", "urls", urls)
 
 	// For activities with missing bookingUrl, assign the next available URL
 	urlIndex := 0
 	for i := range activities {
 		if activities[i].BookingURL == "" && urlIndex < len(urls) {
 			activities[i].BookingURL = urls[urlIndex]
-			log.Printf("Assigned URL to activity %s: %s", activities[i].Title, urls[urlIndex])
+			logger.DebugContext(ctx, "Assigned URL to activity", "title", activities[i].Title, "url", urls[urlIndex])
 			urlIndex++
 		}
 	}
@@ -584,8 +758,8 @@ func (c *GeminiClient) extractURLsFromText(text string) []string {
 	return urls
 }
 
-// recoverMissingURLs performs Stage 3: Recover missing URLs with max 2 recovery requests
-func (c *GeminiClient) recoverMissingURLs(activities []Activity) []Activity {
+// recoverMissingURLs performs Stage 3: Recover missing URLs with a limited number of recovery requests
+func (c *GeminiClient) recoverMissingURLs(ctx context.Context, activities []Activity) []Activity {
 	// Count activities with missing URLs
 	missingCount := 0
 	missingIndices := []int{}
@@ -597,14 +771,15 @@ func (c *GeminiClient) recoverMissingURLs(activities []Activity) []Activity {
 	}
 
 	if missingCount == 0 {
-		log.Printf("Stage 3: All activities have URLs, no recovery needed")
+		logger.InfoContext(ctx, "Stage 3: All activities have URLs, no recovery needed")
 		return activities
 	}
 
-	log.Printf("Stage 3: Found %d activities with missing URLs. Attempting recovery (max 2 requests)...", missingCount)
+	// Limit recovery attempts to the configured maximum
+	recoveryLimit := appConfig.Search.URLRecoveryLimit
+
+	logger.InfoContext(ctx, "Stage 3: Found activities with missing URLs, attempting recovery", "missing", missingCount, "maxRequests", recoveryLimit)
 
-	// Limit recovery attempts to max 2
-	recoveryLimit := 2
 	if missingCount < recoveryLimit {
 		recoveryLimit = missingCount
 	}
@@ -612,50 +787,61 @@ func (c *GeminiClient) recoverMissingURLs(activities []Activity) []Activity {
 	recoveredCount := 0
 	stillMissingCount := 0
 
-	// Attempt to recover URLs for up to 2 activities
+	// Attempt to recover URLs for up to recoveryLimit activities
 	for i := 0; i < recoveryLimit; i++ {
+		// Recovery is optional, so skip the remaining attempts once the token budget is used up
+		if err := tokenBudgetError(ctx); err != nil {
+			logger.WarnContext(ctx, "Stage 3: Skipping remaining URL recovery", "error", err)
+			stillMissingCount += recoveryLimit - i
+			break
+		}
+
 		activityIdx := missingIndices[i]
 		activity := activities[activityIdx]
 
-		log.Printf("Stage 3: Attempting to recover URL for activity %d/%d: %s", i+1, recoveryLimit, activity.Title)
+		logger.DebugContext(ctx, "Stage 3: Attempting to recover URL", "attempt", i+1, "of", recoveryLimit, "title", activity.Title)
 
 		// Search for the service URL
-		url, err := c.searchForServiceURL(activity.Title)
+		url, err := c.searchForServiceURL(ctx, activity.Title)
 		if err != nil {
-			log.Printf("Stage 3: Failed to recover URL for '%s': %v", activity.Title, err)
+			logger.WarnContext(ctx, "Stage 3: Failed to recover URL", "title", activity.Title, "error", err)
 			stillMissingCount++
 			continue
 		}
 
 		if url != "" {
 			activities[activityIdx].BookingURL = url
-			log.Printf("Stage 3: Successfully recovered URL for '%s': %s", activity.Title, url)
+			logger.DebugContext(ctx, "Stage 3: Recovered URL", "title", activity.Title, "url", url)
 			recoveredCount++
 		} else {
-			log.Printf("Stage 3: No URL found for '%s'", activity.Title)
+			logger.DebugContext(ctx, "Stage 3: No URL found", "title", activity.Title)
 			stillMissingCount++
 		}
 	}
 
-	// Log remaining missing URLs (beyond the 2 recovery attempts)
+	// Log remaining missing URLs (beyond the recovery attempts)
 	remainingMissing := missingCount - recoveryLimit
 	if remainingMissing > 0 {
-		log.Printf("Stage 3: %d activities still have missing URLs (beyond recovery limit)", remainingMissing)
+		logger.InfoContext(ctx, "Stage 3: Activities still missing URLs beyond recovery limit", "count", remainingMissing)
 		stillMissingCount += remainingMissing
 	}
 
 	// Final summary
-	log.Printf("Stage 3 Summary: Recovered %d URLs, %d still missing out of %d total missing", recoveredCount, stillMissingCount, missingCount)
+	metrics.recordURLRecovery(ctx, recoveredCount, stillMissingCount)
+	logger.InfoContext(ctx, "Stage 3 summary", "recovered", recoveredCount, "stillMissing", stillMissingCount, "totalMissing", missingCount)
 
 	return activities
 }
 
 // searchForServiceURL searches for the official website URL of a service/activity
-func (c *GeminiClient) searchForServiceURL(activityTitle string) (string, error) {
+func (c *GeminiClient) searchForServiceURL(ctx context.Context, activityTitle string) (url string, err error) {
+	ctx, span := tracer.Start(ctx, "searchForServiceURL", trace.WithAttributes(attribute.String("activity.title", activityTitle)))
+	defer func() { endSpan(span, err) }()
+
 	// Build the search prompt for finding the service URL
 	searchPrompt := fmt.Sprintf("Find the official website URL for: %s\n\nProvide ONLY the direct URL to the official website, nothing else.", activityTitle)
 
-	log.Printf("Stage 3 Search Prompt: %s", searchPrompt)
+	logger.DebugContext(ctx, "Stage 3 search prompt", "prompt", searchPrompt)
 
 	// Create the Gemini API request with Google Search tool
 	geminiReq := GeminiRequest{
@@ -681,14 +867,13 @@ func (c *GeminiClient) searchForServiceURL(activityTitle string) (string, error)
 	}
 
 	// Send request to Gemini
-	responseText, err := c.sendGeminiRequest(geminiReq)
+	responseText, err := c.sendGeminiRequest(ctx, geminiReq)
 	if err != nil {
 		return "", fmt.Errorf("failed to search for service URL: %w", err)
 	}
 
 	// Extract URL from response
-	url := c.extractURLFromResponse(responseText)
-	return url, nil
+	return c.extractURLFromResponse(responseText), nil
 }
 
 // extractURLFromResponse extracts a URL from the Gemini response text
@@ -724,7 +909,7 @@ func (c *GeminiClient) extractURLFromResponse(text string) string {
 }
 
 // extractURLsFromGroundingMetadata extracts URLs from the grounding metadata
-func (c *GeminiClient) extractURLsFromGroundingMetadata(metadata *GroundingMetadata) []string {
+func (c *GeminiClient) extractURLsFromGroundingMetadata(ctx context.Context, metadata *GroundingMetadata) []string {
 	var urls []string
 
 	if metadata == nil || len(metadata.GroundingChunks) == 0 {
@@ -734,7 +919,7 @@ func (c *GeminiClient) extractURLsFromGroundingMetadata(metadata *GroundingMetad
 	for i, chunk := range metadata.GroundingChunks {
 		if chunk.Web != nil && chunk.Web.URI != "" {
 			urls = append(urls, chunk.Web.URI)
-			log.Printf("Stage 1: Grounding chunk %d - URI: %s, Title: %s", i, chunk.Web.URI, chunk.Web.Title)
+			logger.DebugContext(ctx, "Stage 1: Grounding chunk", "index", i, "uri", chunk.Web.URI, "title", chunk.Web.Title)
 		}
 	}
 
@@ -742,18 +927,18 @@ func (c *GeminiClient) extractURLsFromGroundingMetadata(metadata *GroundingMetad
 }
 
 // injectGroundingURLsIntoText injects grounding URLs into the response text where "* URL:" appears empty
-func (c *GeminiClient) injectGroundingURLsIntoText(text string, metadata *GroundingMetadata) string {
+func (c *GeminiClient) injectGroundingURLsIntoText(ctx context.Context, text string, metadata *GroundingMetadata) string {
 	if metadata == nil || len(metadata.GroundingChunks) == 0 {
 		return text
 	}
 
 	// Extract URLs from grounding chunks
-	groundingURLs := c.extractURLsFromGroundingMetadata(metadata)
+	groundingURLs := c.extractURLsFromGroundingMetadata(ctx, metadata)
 	if len(groundingURLs) == 0 {
 		return text
 	}
 
-	log.Printf("Injecting %d grounding URLs into response text", len(groundingURLs))
+	logger.DebugContext(ctx, "Injecting grounding URLs into response text", "count", len(groundingURLs))
 
 	// Split text into lines
 	lines := strings.Split(text, "\n")
@@ -766,7 +951,7 @@ func (c *GeminiClient) injectGroundingURLsIntoText(text string, metadata *Ground
 		if (trimmedLine == "* URL:" || trimmedLine == "*   URL:") && urlIndex < len(groundingURLs) {
 			// Replace the line with the URL
 			lines[i] = strings.Replace(line, trimmedLine, strings.TrimPrefix(trimmedLine, "* "), 1) + groundingURLs[urlIndex]
-			log.Printf("Injected URL at line %d: %s", i, groundingURLs[urlIndex])
+			logger.DebugContext(ctx, "Injected URL", "line", i, "url", groundingURLs[urlIndex])
 			urlIndex++
 		}
 	}
@@ -0,0 +1,90 @@
+package schoolsout
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakeGemini answers generateContent calls: the Google Search stage with a
+// fixed summary and the JSON stage with the activities it currently holds
+type fakeGemini struct {
+	mu         sync.Mutex
+	activities []Activity
+	usage      *UsageMetadata
+	status     int             // Answers every call with this status when set
+	searches   []GeminiRequest // Google Search stage requests, in order
+}
+
+// useFakeGemini points the Gemini client at a fakeGemini for the rest of the test
+func useFakeGemini(t *testing.T, activities ...Activity) *fakeGemini {
+	t.Helper()
+	fake := &fakeGemini{activities: activities}
+	server := httptest.NewServer(http.HandlerFunc(fake.serveHTTP))
+	t.Cleanup(server.Close)
+
+	baseURL, credentials := appConfig.Gemini.BaseURL, defaultCredentials
+	appConfig.Gemini.BaseURL = server.URL
+	defaultCredentials = &FakeCredentialProvider{Key: "test-key"}
+	t.Cleanup(func() {
+		appConfig.Gemini.BaseURL = baseURL
+		defaultCredentials = credentials
+	})
+	return fake
+}
+
+// setActivities replaces the activities returned by later searches
+func (g *fakeGemini) setActivities(activities ...Activity) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.activities = activities
+}
+
+// setStatus makes later calls fail with status, or succeed again with 0
+func (g *fakeGemini) setStatus(status int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.status = status
+}
+
+// searchRequests returns the Google Search stage requests received so far
+func (g *fakeGemini) searchRequests() []GeminiRequest {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]GeminiRequest(nil), g.searches...)
+}
+
+func (g *fakeGemini) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	status := g.status
+	g.mu.Unlock()
+	if status != 0 {
+		http.Error(w, `{"error":{"message":"rejected"}}`, status)
+		return
+	}
+
+	var req GeminiRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	g.mu.Lock()
+	text := "Found some holiday activities."
+	if len(req.Tools) > 0 {
+		g.searches = append(g.searches, req)
+	} else {
+		data, _ := json.Marshal(g.activities)
+		text = string(data)
+	}
+	usage := g.usage
+	g.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GeminiResponse{
+		Candidates:    []Candidate{{Content: CandidateContent{Parts: []Part{{Text: text}}}, FinishReason: "STOP"}},
+		UsageMetadata: usage,
+	})
+}
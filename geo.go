@@ -0,0 +1,258 @@
+package schoolsout
+
+import (
+	"context"
+	"embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // Time zones of activities, whatever the runtime image ships
+)
+
+// gazetteerData holds the bundled suburb/postcode dataset
+//
+//go:embed gazetteer/au-places.csv
+var gazetteerData embed.FS
+
+// earthRadiusKm is the mean radius of the Earth, used for great-circle distances
+const earthRadiusKm = 6371.0
+
+// ErrPlaceNotFound is returned when a location can't be geocoded
+var ErrPlaceNotFound = errors.New("place not found")
+
+// Place is a canonical place with coordinates
+type Place struct {
+	Name      string  `json:"name"`
+	State     string  `json:"state,omitempty"`
+	Postcode  string  `json:"postcode,omitempty"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// String formats a place the way Australian addresses end, e.g. "Fremantle WA 6160"
+func (p Place) String() string {
+	return strings.Join(strings.Fields(p.Name+" "+p.State+" "+p.Postcode), " ")
+}
+
+// Geocoder resolves free-text locations to places
+type Geocoder interface {
+	// Geocode returns the place named in location, or ErrPlaceNotFound
+	Geocode(ctx context.Context, location string) (Place, error)
+}
+
+// geocoder resolves search and activity locations
+var geocoder Geocoder = mustLoadGazetteer(appConfig.Geo)
+
+// Gazetteer is an offline Geocoder backed by a list of places. It matches
+// postcodes and whole-word place names, using a state named alongside a place
+// to tell apart places that share a name.
+type Gazetteer struct {
+	places     []Place
+	byName     map[string][]int // normalised name → indexes into places
+	byPostcode map[string][]int
+}
+
+// mustLoadGazetteer loads the bundled dataset, then any extra places in geo.gazetteerFile
+func mustLoadGazetteer(cfg GeoConfig) *Gazetteer {
+	g := &Gazetteer{byName: make(map[string][]int), byPostcode: make(map[string][]int)}
+
+	bundled, err := gazetteerData.Open("gazetteer/au-places.csv")
+	if err == nil {
+		err = g.load(bundled)
+		bundled.Close()
+	}
+	if err != nil {
+		logger.Error("Failed to load bundled gazetteer", "error", err)
+	}
+
+	if cfg.GazetteerFile != "" {
+		f, err := os.Open(cfg.GazetteerFile)
+		if err == nil {
+			err = g.load(f)
+			f.Close()
+		}
+		if err != nil {
+			logger.Error("Failed to load gazetteer", "file", cfg.GazetteerFile, "error", err)
+		}
+	}
+
+	return g
+}
+
+// load reads places from CSV with the header name,state,postcode,latitude,longitude
+func (g *Gazetteer) load(r io.Reader) error {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return err
+	}
+
+	for i, record := range records {
+		if i == 0 || len(record) < 5 {
+			continue // Header or incomplete row
+		}
+		lat, latErr := strconv.ParseFloat(strings.TrimSpace(record[3]), 64)
+		lon, lonErr := strconv.ParseFloat(strings.TrimSpace(record[4]), 64)
+		if latErr != nil || lonErr != nil {
+			return fmt.Errorf("line %d: invalid coordinates", i+1)
+		}
+		g.add(Place{
+			Name:      strings.TrimSpace(record[0]),
+			State:     strings.ToUpper(strings.TrimSpace(record[1])),
+			Postcode:  strings.TrimSpace(record[2]),
+			Latitude:  lat,
+			Longitude: lon,
+		})
+	}
+	return nil
+}
+
+// add indexes a place
+func (g *Gazetteer) add(place Place) {
+	index := len(g.places)
+	g.places = append(g.places, place)
+	name := strings.Join(locationWords(place.Name), " ")
+	g.byName[name] = append(g.byName[name], index)
+	if place.Postcode != "" {
+		g.byPostcode[place.Postcode] = append(g.byPostcode[place.Postcode], index)
+	}
+}
+
+// Geocode implements Geocoder. The longest place name found in location wins,
+// so "South Perth" beats "Perth"; a postcode is used when no name matches.
+func (g *Gazetteer) Geocode(ctx context.Context, location string) (Place, error) {
+	words := locationWords(location)
+	states := make(map[string]bool)
+	var postcodes []string
+	for _, word := range words {
+		upper := strings.ToUpper(word)
+		switch {
+		case australianStates[upper]:
+			states[upper] = true
+		case len(word) == 4 && isDigits(word):
+			postcodes = append(postcodes, word)
+		}
+	}
+
+	// Try every run of words, longest first
+	for length := min(len(words), 4); length > 0; length-- {
+		for start := 0; start+length <= len(words); start++ {
+			candidates := g.byName[strings.Join(words[start:start+length], " ")]
+			if len(candidates) > 0 {
+				return g.pick(candidates, states), nil
+			}
+		}
+	}
+
+	for _, postcode := range postcodes {
+		if candidates := g.byPostcode[postcode]; len(candidates) > 0 {
+			return g.pick(candidates, states), nil
+		}
+	}
+
+	return Place{}, ErrPlaceNotFound
+}
+
+// pick prefers a candidate in one of the states named in the location
+func (g *Gazetteer) pick(candidates []int, states map[string]bool) Place {
+	for _, i := range candidates {
+		if states[g.places[i].State] {
+			return g.places[i]
+		}
+	}
+	return g.places[candidates[0]]
+}
+
+// australianStates are the state and territory abbreviations recognised in locations
+var australianStates = map[string]bool{
+	"WA": true, "NSW": true, "VIC": true, "QLD": true, "SA": true, "TAS": true, "ACT": true, "NT": true,
+}
+
+// stateTimeZones are the IANA time zones of the states and territories
+var stateTimeZones = map[string]string{
+	"WA": "Australia/Perth", "NSW": "Australia/Sydney", "VIC": "Australia/Melbourne", "QLD": "Australia/Brisbane",
+	"SA": "Australia/Adelaide", "TAS": "Australia/Hobart", "ACT": "Australia/Sydney", "NT": "Australia/Darwin",
+}
+
+// timeZone returns the time zone of a place, or nil when its state isn't known
+func (p Place) timeZone() *time.Location {
+	name, ok := stateTimeZones[p.State]
+	if !ok {
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil
+	}
+	return loc
+}
+
+// isDigits reports whether s is made only of ASCII digits
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// distanceKm returns the great-circle distance between two places
+func distanceKm(a, b Place) float64 {
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// resolvePlace geocodes the search location into req.place. The location the
+// client typed stays as it was, for the prompt and anything saved from the
+// request. A radius search needs a place; other searches go ahead without one.
+func (req *SearchRequest) resolvePlace(ctx context.Context) error {
+	if req.Location == "" {
+		if req.RadiusKm > 0 {
+			return fmt.Errorf("location is required for a radius search")
+		}
+		return nil
+	}
+
+	place, err := geocoder.Geocode(ctx, req.Location)
+	if err != nil {
+		if req.RadiusKm > 0 {
+			return fmt.Errorf("location %q could not be found for a radius search", req.Location)
+		}
+		logger.DebugContext(ctx, "Location not geocoded", "location", req.Location, "error", err)
+		return nil
+	}
+
+	req.place = &place
+	return nil
+}
+
+// applyDistances geocodes each activity's location and sets its distance from
+// the search place. A radius search drops activities known to be further away.
+func applyDistances(ctx context.Context, activities []Activity, req *SearchRequest) []Activity {
+	if req.place == nil {
+		return activities
+	}
+
+	filtered := activities[:0]
+	for _, activity := range activities {
+		if place, err := geocoder.Geocode(ctx, activity.Location); err == nil {
+			distance := math.Round(distanceKm(*req.place, place)*10) / 10
+			activity.DistanceKm = &distance
+			if req.RadiusKm > 0 && distance > req.RadiusKm {
+				continue
+			}
+		}
+		filtered = append(filtered, activity)
+	}
+	return filtered
+}
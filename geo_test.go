@@ -0,0 +1,111 @@
+package schoolsout
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestGazetteerGeocode(t *testing.T) {
+	tests := []struct {
+		location string
+		want     string
+		err      error
+	}{
+		{"Perth", "Perth WA 6000", nil},
+		{"things to do near fremantle", "Fremantle WA 6160", nil},
+		{"South Perth, WA", "South Perth WA 6151", nil},
+		{"6160", "Fremantle WA 6160", nil},
+		{"Richmond VIC", "Richmond VIC 3121", nil},
+		{"Richmond, NSW", "Richmond NSW 2753", nil},
+		{"Atlantis", "", ErrPlaceNotFound},
+		{"", "", ErrPlaceNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.location, func(t *testing.T) {
+			place, err := geocoder.Geocode(context.Background(), tt.location)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Geocode(%q) error = %v, want %v", tt.location, err, tt.err)
+			}
+			if err == nil && place.String() != tt.want {
+				t.Errorf("Geocode(%q) = %q, want %q", tt.location, place, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistanceKm(t *testing.T) {
+	perth := Place{Latitude: -31.9523, Longitude: 115.8613}
+	fremantle := Place{Latitude: -32.0569, Longitude: 115.7439}
+	sydney := Place{Latitude: -33.8688, Longitude: 151.2093}
+
+	tests := []struct {
+		name string
+		a, b Place
+		want float64
+	}{
+		{"same place", perth, perth, 0},
+		{"Perth to Fremantle", perth, fremantle, 16},
+		{"Perth to Sydney", perth, sydney, 3290},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := distanceKm(tt.a, tt.b)
+			if math.Abs(got-tt.want) > tt.want*0.02+0.01 {
+				t.Errorf("distanceKm = %.1f, want about %.0f", got, tt.want)
+			}
+			if back := distanceKm(tt.b, tt.a); math.Abs(back-got) > 1e-9 {
+				t.Errorf("distance back = %.3f, there = %.3f", back, got)
+			}
+		})
+	}
+}
+
+func TestResolvePlaceKeepsLocation(t *testing.T) {
+	req := SearchRequest{Query: "parks", Location: "near fremantle, wa"}
+	if err := req.resolvePlace(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if req.Location != "near fremantle, wa" {
+		t.Errorf("Location = %q, want the client's text", req.Location)
+	}
+	if req.place == nil || req.place.String() != "Fremantle WA 6160" {
+		t.Errorf("place = %v, want Fremantle WA 6160", req.place)
+	}
+
+	unknown := SearchRequest{Query: "parks", Location: "Atlantis"}
+	if err := unknown.resolvePlace(context.Background()); err != nil || unknown.place != nil {
+		t.Errorf("unknown location: place %v, error %v; want neither", unknown.place, err)
+	}
+	radius := SearchRequest{Query: "parks", Location: "Atlantis", RadiusKm: 10}
+	if err := radius.resolvePlace(context.Background()); err == nil {
+		t.Error("radius search of an unknown location was accepted")
+	}
+	noLocation := SearchRequest{Query: "parks", RadiusKm: 10}
+	if err := noLocation.resolvePlace(context.Background()); err == nil {
+		t.Error("radius search without a location was accepted")
+	}
+}
+
+func TestApplyDistances(t *testing.T) {
+	req := SearchRequest{Location: "Perth", RadiusKm: 20}
+	if err := req.resolvePlace(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	activities := applyDistances(context.Background(), []Activity{
+		{Title: "Beach", Location: "Fremantle"},
+		{Title: "Harbour", Location: "Sydney"},
+		{Title: "Somewhere", Location: "Unknown venue"},
+	}, &req)
+
+	if len(activities) != 2 || activities[0].Title != "Beach" || activities[1].Title != "Somewhere" {
+		t.Fatalf("activities = %+v, want Beach and Somewhere", activities)
+	}
+	if d := activities[0].DistanceKm; d == nil || *d < 15 || *d > 17 {
+		t.Errorf("Beach distance = %v, want about 16 km", d)
+	}
+	if activities[1].DistanceKm != nil {
+		t.Errorf("ungeocoded activity has distance %v", *activities[1].DistanceKm)
+	}
+}
@@ -0,0 +1,172 @@
+package schoolsout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Component status values reported by /healthz and /readyz
+const (
+	healthStatusOK          = "ok"
+	healthStatusUnavailable = "unavailable"
+	healthStatusError       = "error"
+)
+
+// HealthCheck checks that one dependency is usable
+type HealthCheck interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+// healthCheckFunc adapts a function to HealthCheck
+type healthCheckFunc struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// Name implements HealthCheck
+func (h healthCheckFunc) Name() string {
+	return h.name
+}
+
+// Check implements HealthCheck
+func (h healthCheckFunc) Check(ctx context.Context) error {
+	return h.check(ctx)
+}
+
+// ComponentStatus represents the health of a single dependency. /readyz is
+// public, so why a check failed is only logged.
+type ComponentStatus struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latencyMs"`
+}
+
+// HealthResponse represents the response model for health and readiness checks
+type HealthResponse struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentStatus `json:"components,omitempty"`
+}
+
+var (
+	// readinessChecks are run by /readyz; storage backends add themselves with registerReadinessCheck
+	readinessChecks = []HealthCheck{
+		healthCheckFunc{name: "credentials", check: checkCredentials},
+		&cachedHealthCheck{check: healthCheckFunc{name: "gemini", check: checkGemini}},
+	}
+	readinessChecksMux sync.RWMutex
+)
+
+// registerReadinessCheck adds a dependency check to /readyz
+func registerReadinessCheck(check HealthCheck) {
+	readinessChecksMux.Lock()
+	defer readinessChecksMux.Unlock()
+	readinessChecks = append(readinessChecks, check)
+}
+
+// handleHealthz reports that the instance is alive. It never calls dependencies,
+// so a slow Gemini API cannot get a healthy instance restarted.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(HealthResponse{Status: healthStatusOK})
+}
+
+// handleReadyz runs every readiness check and reports each component's status.
+// Any failing component makes the instance unavailable (503).
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	readinessChecksMux.RLock()
+	checks := append([]HealthCheck(nil), readinessChecks...)
+	readinessChecksMux.RUnlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(appConfig.Health.Timeout))
+	defer cancel()
+
+	// Run checks concurrently so the probe takes as long as the slowest check
+	response := HealthResponse{Status: healthStatusOK, Components: make(map[string]ComponentStatus, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+			start := time.Now()
+			err := check.Check(ctx)
+			status := ComponentStatus{Status: healthStatusOK, LatencyMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				status.Status = healthStatusError
+				logger.WarnContext(ctx, "Readiness check failed", "component", check.Name(), "error", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			response.Components[check.Name()] = status
+			if err != nil {
+				response.Status = healthStatusUnavailable
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	statusCode := http.StatusOK
+	if response.Status != healthStatusOK {
+		statusCode = http.StatusServiceUnavailable
+	}
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
+
+// checkCredentials verifies that a Gemini API key can still be resolved. It
+// asks the providers behind the credential cache, which would otherwise report
+// the key resolved at startup after its source had gone.
+func checkCredentials(ctx context.Context) error {
+	provider := defaultCredentials
+	if cached, ok := provider.(*cachedCredentialProvider); ok {
+		provider = cached.provider
+	}
+	if _, err := provider.APIKey(ctx); err != nil {
+		return fmt.Errorf("Gemini API key not available")
+	}
+	return nil
+}
+
+// checkGemini verifies that the Gemini API accepts the key and knows the configured model
+func checkGemini(ctx context.Context) error {
+	client := NewGeminiClient(ctx)
+	if client.APIKey == "" {
+		return fmt.Errorf("Gemini API key not available")
+	}
+	return client.getModel(ctx)
+}
+
+// cachedHealthCheck reuses a check's result for health.cacheTTL so frequent
+// probes don't turn into a steady stream of calls to external APIs
+type cachedHealthCheck struct {
+	check HealthCheck
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// Name implements HealthCheck
+func (c *cachedHealthCheck) Name() string {
+	return c.check.Name()
+}
+
+// Check implements HealthCheck
+func (c *cachedHealthCheck) Check(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hit := !c.checkedAt.IsZero() && time.Since(c.checkedAt) < time.Duration(appConfig.Health.CacheTTL)
+	metrics.recordCacheLookup(ctx, "health", hit)
+	if hit {
+		return c.err
+	}
+	c.err = c.check.Check(ctx)
+	c.checkedAt = time.Now()
+	return c.err
+}
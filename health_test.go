@@ -0,0 +1,59 @@
+package schoolsout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckCredentialsBypassesCache(t *testing.T) {
+	previous := defaultCredentials
+	t.Cleanup(func() { defaultCredentials = previous })
+
+	source := &FakeCredentialProvider{Key: "test-key"}
+	defaultCredentials = &cachedCredentialProvider{provider: source}
+	if err := checkCredentials(context.Background()); err != nil {
+		t.Fatalf("checkCredentials = %v", err)
+	}
+	if _, err := defaultCredentials.APIKey(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The cache still holds the key, but its source has gone
+	source.Err = errors.New("secret deleted")
+	if err := checkCredentials(context.Background()); err == nil {
+		t.Error("checkCredentials passed with the key's source failing")
+	}
+}
+
+func TestReadyzReportsEachComponent(t *testing.T) {
+	readinessChecksMux.Lock()
+	previous := readinessChecks
+	readinessChecks = []HealthCheck{
+		healthCheckFunc{name: "up", check: func(ctx context.Context) error { return nil }},
+		healthCheckFunc{name: "down", check: func(ctx context.Context) error { return errors.New("unreachable") }},
+	}
+	readinessChecksMux.Unlock()
+	t.Cleanup(func() {
+		readinessChecksMux.Lock()
+		readinessChecks = previous
+		readinessChecksMux.Unlock()
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var response HealthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusServiceUnavailable || response.Status != healthStatusUnavailable {
+		t.Errorf("status = %d %q, want 503 %q", rec.Code, response.Status, healthStatusUnavailable)
+	}
+	if response.Components["up"].Status != healthStatusOK || response.Components["down"].Status != healthStatusError {
+		t.Errorf("components = %+v", response.Components)
+	}
+}
@@ -0,0 +1,261 @@
+package schoolsout
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// holidayData holds the bundled school holiday calendars, one YAML file per region
+//
+//go:embed holidays/*.yaml
+var holidayData embed.FS
+
+// HolidayRegion is the school holiday calendar of one state or region
+type HolidayRegion struct {
+	Region   string          `yaml:"region"` // e.g. AU-WA
+	Name     string          `yaml:"name"`
+	Source   string          `yaml:"source"`  // Where the dates were published
+	Aliases  []string        `yaml:"aliases"` // Place names in a Location that select this region
+	Holidays []holidayPeriod `yaml:"holidays"`
+}
+
+// holidayPeriod is one school holiday period as written in a calendar file
+type holidayPeriod struct {
+	Name  string `yaml:"name"`
+	Start string `yaml:"start"` // yyyy-MM-dd
+	End   string `yaml:"end"`   // yyyy-MM-dd, inclusive
+}
+
+// HolidayWindow is the school holiday period a search without dates was resolved to
+type HolidayWindow struct {
+	Region     string `json:"region"`
+	RegionName string `json:"regionName"`
+	Name       string `json:"name"`
+	StartDate  string `json:"startDate"`
+	EndDate    string `json:"endDate"`
+}
+
+// holidayCalendar holds every loaded region, keyed by region code
+var holidayCalendar = mustLoadHolidayCalendar(appConfig.Holidays)
+
+// mustLoadHolidayCalendar loads the bundled calendars, then any calendar files in
+// holidays.dir, which replace bundled regions with the same code
+func mustLoadHolidayCalendar(cfg HolidaysConfig) map[string]*HolidayRegion {
+	calendar := make(map[string]*HolidayRegion)
+
+	bundled, _ := fs.Sub(holidayData, "holidays")
+	if err := loadHolidayFiles(bundled, calendar); err != nil {
+		logger.Error("Failed to load bundled school holiday calendars", "error", err)
+	}
+	if cfg.Dir != "" {
+		if err := loadHolidayFiles(os.DirFS(cfg.Dir), calendar); err != nil {
+			logger.Error("Failed to load school holiday calendars", "dir", cfg.Dir, "error", err)
+		}
+	}
+
+	return calendar
+}
+
+// loadHolidayFiles reads every .yaml/.yml/.json calendar file in fsys into calendar
+func loadHolidayFiles(fsys fs.FS, calendar map[string]*HolidayRegion) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".yaml", ".yml", ".json":
+		default:
+			continue
+		}
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return err
+		}
+		var region HolidayRegion
+		if err := yaml.Unmarshal(data, &region); err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		if err := region.validate(); err != nil {
+			return fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+		sort.Slice(region.Holidays, func(i, j int) bool {
+			return region.Holidays[i].Start < region.Holidays[j].Start
+		})
+		calendar[strings.ToUpper(region.Region)] = &region
+	}
+	return nil
+}
+
+// validate checks that a calendar file is usable
+func (h *HolidayRegion) validate() error {
+	if strings.TrimSpace(h.Region) == "" {
+		return fmt.Errorf("region must not be empty")
+	}
+	for _, period := range h.Holidays {
+		start, err := time.Parse("2006-01-02", period.Start)
+		if err != nil {
+			return fmt.Errorf("%s: start must be a date in yyyy-MM-dd format", period.Name)
+		}
+		end, err := time.Parse("2006-01-02", period.End)
+		if err != nil {
+			return fmt.Errorf("%s: end must be a date in yyyy-MM-dd format", period.Name)
+		}
+		if end.Before(start) {
+			return fmt.Errorf("%s: end must not be before start", period.Name)
+		}
+	}
+	return nil
+}
+
+// holidayRegionFor returns the region whose alias appears in location as whole
+// words, preferring the longest alias ("Western Australia" over "WA")
+func holidayRegionFor(location string) *HolidayRegion {
+	words := " " + strings.Join(locationWords(location), " ") + " "
+
+	var best *HolidayRegion
+	bestLength := 0
+	for _, code := range sortedHolidayRegions() {
+		region := holidayCalendar[code]
+		for _, alias := range region.Aliases {
+			aliasWords := strings.Join(locationWords(alias), " ")
+			if aliasWords == "" || len(aliasWords) <= bestLength {
+				continue
+			}
+			if strings.Contains(words, " "+aliasWords+" ") {
+				best, bestLength = region, len(aliasWords)
+			}
+		}
+	}
+	return best
+}
+
+// sortedHolidayRegions returns the region codes in a stable order
+func sortedHolidayRegions() []string {
+	codes := make([]string, 0, len(holidayCalendar))
+	for code := range holidayCalendar {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// locationWords lower-cases a place name and splits it into words
+func locationWords(location string) []string {
+	return strings.FieldsFunc(strings.ToLower(location), func(r rune) bool {
+		return !('a' <= r && r <= 'z') && !('0' <= r && r <= '9')
+	})
+}
+
+// nextWindow returns the holiday period in progress on day, or the next one to
+// start. A period in progress starts from day rather than its first day.
+func (h *HolidayRegion) nextWindow(day time.Time) *HolidayWindow {
+	today := day.Format("2006-01-02")
+	for _, period := range h.Holidays {
+		if period.End < today {
+			continue
+		}
+		start := period.Start
+		if start < today {
+			start = today
+		}
+		return &HolidayWindow{
+			Region:     h.Region,
+			RegionName: h.Name,
+			Name:       period.Name,
+			StartDate:  start,
+			EndDate:    period.End,
+		}
+	}
+	return nil
+}
+
+// lastDay returns the last holiday on file, or "" for an empty calendar
+func (h *HolidayRegion) lastDay() string {
+	last := ""
+	for _, period := range h.Holidays {
+		last = max(last, period.End)
+	}
+	return last
+}
+
+// resolveHolidayWindow gives a search without dates the next school holidays of
+// the region named in its Location. It returns nil, leaving req unchanged, when
+// the request has dates, no known region or no upcoming holidays on file, and
+// an error for a place in a state whose holidays aren't bundled.
+func (req *SearchRequest) resolveHolidayWindow(now time.Time) (*HolidayWindow, error) {
+	if err := req.checkHolidayCalendar(); err != nil {
+		return nil, err
+	}
+	region := req.holidayRegion()
+	if req.DateRange != nil || region == nil {
+		return nil, nil
+	}
+	window := region.nextWindow(now)
+	if window == nil {
+		// The calendar has run out; the search goes ahead without dates
+		logger.Warn("School holiday calendar has no holidays after this date",
+			"region", region.Region, "date", now.Format("2006-01-02"), "calendarEnd", region.lastDay())
+		return nil, nil
+	}
+
+	req.DateRange = &DateRange{StartDate: window.StartDate, EndDate: window.EndDate}
+	req.holiday = window
+	return window, nil
+}
+
+// holidayRegion returns the calendar for the search location. A geocoded place
+// names its state; otherwise it looks for a region's place names.
+func (req *SearchRequest) holidayRegion() *HolidayRegion {
+	if req.Location == "" {
+		return nil
+	}
+	if req.place != nil {
+		if region, ok := holidayCalendar["AU-"+req.place.State]; ok {
+			return region
+		}
+	}
+	return holidayRegionFor(req.Location)
+}
+
+// checkHolidayCalendar rejects a search without dates at a place in a state with
+// no school holiday calendar (SA, TAS, ACT and NT aren't bundled), rather than
+// searching an unrelated region's holidays or no dates at all
+func (req *SearchRequest) checkHolidayCalendar() error {
+	if req.DateRange != nil || req.place == nil || req.place.State == "" {
+		return nil
+	}
+	if _, ok := holidayCalendar["AU-"+req.place.State]; ok {
+		return nil
+	}
+	return fmt.Errorf("school holiday dates for %s are not available; give a dateRange to search there", req.place.State)
+}
+
+// filterByDateRange drops activities whose date is known to fall outside the range.
+// Activities without a parseable date are kept.
+func filterByDateRange(activities []Activity, dateRange *DateRange) []Activity {
+	if dateRange == nil {
+		return activities
+	}
+
+	filtered := activities[:0]
+	for _, activity := range activities {
+		if _, err := time.Parse("2006-01-02", activity.Date); err == nil {
+			if activity.Date < dateRange.StartDate || activity.Date > dateRange.EndDate {
+				continue
+			}
+		}
+		filtered = append(filtered, activity)
+	}
+	return filtered
+}
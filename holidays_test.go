@@ -0,0 +1,86 @@
+package schoolsout
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBundledHolidayCalendars(t *testing.T) {
+	calendar := mustLoadHolidayCalendar(HolidaysConfig{})
+	seen := make(map[string]string)
+	for _, code := range []string{"AU-NSW", "AU-QLD", "AU-VIC", "AU-WA"} {
+		region, ok := calendar[code]
+		if !ok {
+			t.Errorf("%s: no bundled calendar", code)
+			continue
+		}
+		if last := region.lastDay(); last < "2027-12-31" {
+			t.Errorf("%s: calendar ends on %s, want holidays through 2027", code, last)
+		}
+		// Copying a calendar file for a new state is an easy mistake
+		dates := fmt.Sprint(region.Holidays)
+		if other, ok := seen[dates]; ok {
+			t.Errorf("%s has the same holidays as %s", code, other)
+		}
+		seen[dates] = code
+	}
+}
+
+func TestResolveHolidayWindow(t *testing.T) {
+	tests := []struct {
+		name string
+		now  string
+		want *DateRange
+	}{
+		{"during holidays", "2027-07-10", &DateRange{StartDate: "2027-07-10", EndDate: "2027-07-18"}},
+		{"before holidays", "2027-07-01", &DateRange{StartDate: "2027-07-03", EndDate: "2027-07-18"}},
+		{"after the calendar", "2031-01-01", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, _ := time.Parse("2006-01-02", tt.now)
+			req := SearchRequest{Location: "Perth"}
+			if _, err := req.resolveHolidayWindow(now); err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tt.want == nil && req.DateRange != nil:
+				t.Errorf("DateRange = %+v, want none", *req.DateRange)
+			case tt.want != nil && (req.DateRange == nil || *req.DateRange != *tt.want):
+				t.Errorf("DateRange = %+v, want %+v", req.DateRange, *tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveHolidayWindowWithoutCalendar(t *testing.T) {
+	now, _ := time.Parse("2006-01-02", "2027-07-01")
+	tests := []struct {
+		name      string
+		location  string
+		dateRange *DateRange
+		wantErr   bool
+	}{
+		{"state with a calendar", "Perth", nil, false},
+		{"SA without dates", "Adelaide", nil, true},
+		{"TAS without dates", "Hobart", nil, true},
+		{"ACT without dates", "Canberra", nil, true},
+		{"NT without dates", "Darwin", nil, true},
+		{"SA with dates", "Adelaide", &DateRange{StartDate: "2027-07-05", EndDate: "2027-07-10"}, false},
+		{"unknown place", "Atlantis", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := SearchRequest{Query: "parks", Location: tt.location, DateRange: tt.dateRange}
+			if err := req.resolvePlace(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			_, err := req.resolveHolidayWindow(now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
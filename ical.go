@@ -0,0 +1,190 @@
+package schoolsout
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// RFC 5545 DATE, UTC DATE-TIME and floating DATE-TIME layouts
+const (
+	icsDateLayout      = "20060102"
+	icsTimestampLayout = "20060102T150405Z"
+	icsLocalTimeLayout = "20060102T150405"
+)
+
+// icsProductID identifies this service in the calendars it produces
+const icsProductID = "-//schoolsout-app-suggestions//Activities//EN"
+
+// icsMaxLineOctets is the longest content line RFC 5545 allows before folding
+const icsMaxLineOctets = 75
+
+// calendarEvent is one VEVENT of a calendar
+type calendarEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Date        time.Time // The event lasts all of this day, unless Start is set
+	Start       time.Time // Start of a timed event
+	End         time.Time // End of a timed event; optional
+	Floating    bool      // Start and End are in the attendee's time zone, as the venue's isn't known
+}
+
+// activityEvent describes an activity taking place on day as a calendar event.
+// An activity with a start time is a timed event in the time zone of its
+// location; otherwise it lasts all day.
+func activityEvent(ctx context.Context, activity Activity, day time.Time) calendarEvent {
+	description := activity.Description
+	if activity.Price != "" {
+		description += "\n\nPrice: " + activity.Price
+	}
+	if activity.BookingURL != "" {
+		description += "\nBooking: " + activity.BookingURL
+	}
+
+	event := calendarEvent{
+		UID:         activity.ID + "-" + day.Format(icsDateLayout) + "@schoolsout",
+		Summary:     activity.Title,
+		Description: strings.TrimSpace(description),
+		Location:    activity.Location,
+		URL:         activity.BookingURL,
+		Date:        day,
+	}
+
+	start, err := time.Parse("15:04", strings.TrimSpace(activity.StartTime))
+	if err != nil {
+		return event
+	}
+	loc := time.UTC
+	event.Floating = true
+	if place, err := geocoder.Geocode(ctx, activity.Location); err == nil {
+		if zone := place.timeZone(); zone != nil {
+			loc, event.Floating = zone, false
+		}
+	}
+	event.Start = time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, loc)
+	if end, err := time.Parse("15:04", strings.TrimSpace(activity.EndTime)); err == nil {
+		if end := time.Date(day.Year(), day.Month(), day.Day(), end.Hour(), end.Minute(), 0, 0, loc); end.After(event.Start) {
+			event.End = end
+		}
+	}
+	return event
+}
+
+// activityEvents describes the dated activities of a search result as calendar
+// events; activities without a date can't be placed in a calendar
+func activityEvents(ctx context.Context, activities []Activity) []calendarEvent {
+	events := make([]calendarEvent, 0, len(activities))
+	for _, activity := range activities {
+		day, err := time.Parse("2006-01-02", activity.Date)
+		if err != nil {
+			continue
+		}
+		events = append(events, activityEvent(ctx, activity, day))
+	}
+	return events
+}
+
+// writeCalendarResponse sends events as an iCalendar file, cached like JSON
+// responses so calendar apps subscribed to a search URL poll cheaply
+func writeCalendarResponse(w http.ResponseWriter, r *http.Request, name, filename string, events []calendarEvent, maxAge time.Duration) {
+	var body strings.Builder
+	if err := writeCalendar(&body, name, events); err != nil {
+		logger.ErrorContext(r.Context(), "Failed to write calendar", "error", err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to encode response")
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="`+filename+`"`)
+	writeCacheable(w, r, []byte(body.String()), maxAge)
+}
+
+// writeCalendar writes events as an RFC 5545 calendar called name
+func writeCalendar(w io.Writer, name string, events []calendarEvent) error {
+	var b strings.Builder
+	line := func(content string) {
+		b.WriteString(foldICSLine(content))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:" + icsProductID)
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + escapeICSText(name))
+
+	// A stamp that only changes hourly keeps the ETag of an unchanged calendar stable
+	stamp := time.Now().UTC().Truncate(time.Hour).Format(icsTimestampLayout)
+	for _, event := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + escapeICSText(event.UID))
+		line("DTSTAMP:" + stamp)
+		switch {
+		case event.Start.IsZero():
+			line("DTSTART;VALUE=DATE:" + event.Date.Format(icsDateLayout))
+			line("DTEND;VALUE=DATE:" + event.Date.AddDate(0, 0, 1).Format(icsDateLayout))
+		case event.Floating:
+			line("DTSTART:" + event.Start.Format(icsLocalTimeLayout))
+			if !event.End.IsZero() {
+				line("DTEND:" + event.End.Format(icsLocalTimeLayout))
+			}
+		default:
+			line("DTSTART:" + event.Start.UTC().Format(icsTimestampLayout))
+			if !event.End.IsZero() {
+				line("DTEND:" + event.End.UTC().Format(icsTimestampLayout))
+			}
+		}
+		line("SUMMARY:" + escapeICSText(event.Summary))
+		if event.Description != "" {
+			line("DESCRIPTION:" + escapeICSText(event.Description))
+		}
+		if event.Location != "" {
+			line("LOCATION:" + escapeICSText(event.Location))
+		}
+		if event.URL != "" {
+			line("URL:" + strings.NewReplacer("\r", "", "\n", "").Replace(event.URL))
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// icsTextEscaper escapes the characters RFC 5545 TEXT values reserve
+var icsTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// escapeICSText escapes a TEXT property value
+func escapeICSText(text string) string {
+	return icsTextEscaper.Replace(text)
+}
+
+// foldICSLine splits a content line longer than 75 octets into continuation
+// lines starting with a space, without splitting a UTF-8 character
+func foldICSLine(content string) string {
+	if len(content) <= icsMaxLineOctets {
+		return content
+	}
+
+	var b strings.Builder
+	limit := icsMaxLineOctets
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		b.WriteString(content[:cut])
+		b.WriteString("\r\n ")
+		content = content[cut:]
+		limit = icsMaxLineOctets - 1 // The leading space counts towards the line
+	}
+	b.WriteString(content)
+	return b.String()
+}
@@ -0,0 +1,161 @@
+package schoolsout
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestFoldICSLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		lines   []string
+	}{
+		{"short", "SUMMARY:Zoo", []string{"SUMMARY:Zoo"}},
+		{"exactly 75 octets", strings.Repeat("a", 75), []string{strings.Repeat("a", 75)}},
+		{"76 octets", strings.Repeat("a", 76), []string{strings.Repeat("a", 75), " a"}},
+		{"two-byte character across the boundary", strings.Repeat("a", 74) + "éb", []string{strings.Repeat("a", 74), " éb"}},
+		{"two-byte character ending at the boundary", strings.Repeat("a", 73) + "éb", []string{strings.Repeat("a", 73) + "é", " b"}},
+		{"four-byte character across the boundary", strings.Repeat("a", 73) + "🦘", []string{strings.Repeat("a", 73), " 🦘"}},
+		{"continuation lines count the space", strings.Repeat("a", 75+74+1), []string{strings.Repeat("a", 75), " " + strings.Repeat("a", 74), " a"}},
+		{"all multibyte", strings.Repeat("é", 40), []string{strings.Repeat("é", 37), " é" + strings.Repeat("é", 2)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Split(foldICSLine(tt.content), "\r\n")
+			if strings.Join(got, "|") != strings.Join(tt.lines, "|") {
+				t.Fatalf("foldICSLine() lines = %q, want %q", got, tt.lines)
+			}
+			for _, line := range got {
+				if len(line) > icsMaxLineOctets || !utf8.ValidString(line) {
+					t.Errorf("line %q is %d octets or splits a character", line, len(line))
+				}
+			}
+			if unfolded := strings.ReplaceAll(strings.Join(got, "\r\n"), "\r\n ", ""); unfolded != tt.content {
+				t.Errorf("unfolded line = %q, want %q", unfolded, tt.content)
+			}
+		})
+	}
+}
+
+func TestEscapeICSText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Zoo day", "Zoo day"},
+		{"Zoo, aquarium; museum", `Zoo\, aquarium\; museum`},
+		{`C:\path`, `C:\\path`},
+		{`\n`, `\\n`},
+		{"one\ntwo", `one\ntwo`},
+		{"one\r\ntwo", `one\ntwo`},
+		{"one\rtwo", `one\ntwo`},
+		{"Café: 10:00", "Café: 10:00"},
+	}
+	for _, tt := range tests {
+		if got := escapeICSText(tt.text); got != tt.want {
+			t.Errorf("escapeICSText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCalendarEventTimes(t *testing.T) {
+	day := time.Date(2027, time.July, 5, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		activity Activity
+		want     []string
+		notWant  string
+	}{
+		{
+			name:     "all day",
+			activity: Activity{ID: "a", Title: "Zoo", Location: "Perth"},
+			want:     []string{"DTSTART;VALUE=DATE:20270705", "DTEND;VALUE=DATE:20270706"},
+		},
+		{
+			name:     "timed in the venue's time zone",
+			activity: Activity{ID: "a", Title: "Zoo", Location: "Perth", StartTime: "09:30", EndTime: "11:00"},
+			want:     []string{"DTSTART:20270705T013000Z", "DTEND:20270705T030000Z"},
+		},
+		{
+			name:     "timed with daylight saving",
+			activity: Activity{ID: "a", Title: "Zoo", Location: "Richmond VIC", StartTime: "09:30"},
+			want:     []string{"DTSTART:20270704T233000Z"},
+			notWant:  "DTEND",
+		},
+		{
+			name:     "floating when the venue is unknown",
+			activity: Activity{ID: "a", Title: "Zoo", Location: "Atlantis", StartTime: "09:30", EndTime: "11:00"},
+			want:     []string{"DTSTART:20270705T093000", "DTEND:20270705T110000"},
+		},
+		{
+			name:     "end before start is dropped",
+			activity: Activity{ID: "a", Title: "Zoo", Location: "Atlantis", StartTime: "14:00", EndTime: "09:00"},
+			want:     []string{"DTSTART:20270705T140000"},
+			notWant:  "DTEND",
+		},
+		{
+			name:     "unparseable start time is all day",
+			activity: Activity{ID: "a", Title: "Zoo", StartTime: "morning"},
+			want:     []string{"DTSTART;VALUE=DATE:20270705"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := activityEvent(context.Background(), tt.activity, day)
+			var b strings.Builder
+			if err := writeCalendar(&b, "Holidays", []calendarEvent{event}); err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(b.String(), "\r\n")
+			for _, want := range tt.want {
+				if !slices.Contains(lines, want) {
+					t.Errorf("calendar has no line %q:\n%s", want, b.String())
+				}
+			}
+			if tt.notWant != "" && strings.Contains(b.String(), tt.notWant) {
+				t.Errorf("calendar holds %q:\n%s", tt.notWant, b.String())
+			}
+		})
+	}
+}
+
+func TestWriteCalendarEscapesAndFolds(t *testing.T) {
+	event := calendarEvent{
+		UID:         "a-20270705@schoolsout",
+		Summary:     "Zoo, aquarium; and more",
+		Description: strings.Repeat("Kangaroos, koalas 🦘 ", 6),
+		URL:         "https://example.com/book\r\nX-INJECTED:1",
+		Date:        time.Date(2027, time.July, 5, 0, 0, 0, 0, time.UTC),
+	}
+	var b strings.Builder
+	if err := writeCalendar(&b, "Holidays, Perth", []calendarEvent{event}); err != nil {
+		t.Fatal(err)
+	}
+	body := b.String()
+	if !strings.HasSuffix(body, "END:VCALENDAR\r\n") {
+		t.Errorf("calendar doesn't end with END:VCALENDAR and CRLF:\n%s", body)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(body, "\r\n"), "\r\n")
+	for _, line := range lines {
+		if len(line) > icsMaxLineOctets || !utf8.ValidString(line) {
+			t.Errorf("line %q is %d octets or splits a character", line, len(line))
+		}
+	}
+	unfolded := strings.Split(strings.ReplaceAll(body, "\r\n ", ""), "\r\n")
+	for _, want := range []string{
+		`X-WR-CALNAME:Holidays\, Perth`,
+		`SUMMARY:Zoo\, aquarium\; and more`,
+		"DESCRIPTION:" + escapeICSText(event.Description),
+		"URL:https://example.com/bookX-INJECTED:1",
+	} {
+		if !slices.Contains(unfolded, want) {
+			t.Errorf("calendar has no line %q:\n%s", want, body)
+		}
+	}
+}
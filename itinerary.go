@@ -0,0 +1,326 @@
+package schoolsout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Limits of an itinerary
+const (
+	maxItineraryDays        = 31 // Days in the plan, after weekdaysOnly
+	maxActivitiesPerDay     = 3
+	maxItinerarySearches    = 3 // Searches run to gather enough activities to fill the plan
+	defaultActivitiesPerDay = 1
+)
+
+// ItineraryRequest asks for a day-by-day plan over the dates of a search
+type ItineraryRequest struct {
+	Search      SearchRequest        `json:"search"`
+	Constraints ItineraryConstraints `json:"constraints"`
+}
+
+// ItineraryConstraints shape an itinerary. Activities on the same day are from
+// different categories, and each pick favours the category used least so far.
+type ItineraryConstraints struct {
+	ActivitiesPerDay int      `json:"activitiesPerDay,omitempty"` // Default 1
+	WeekdaysOnly     bool     `json:"weekdaysOnly,omitempty"`
+	Budget           *float64 `json:"budget,omitempty"`      // Total across the plan; activities with an unknown price are left out
+	MaxTravelKm      float64  `json:"maxTravelKm,omitempty"` // From the search location; activities at an unknown distance are left out
+	Categories       []string `json:"categories,omitempty"`  // Taxonomy categories to mix; default any
+}
+
+// Itinerary is a day-by-day plan of activities
+type Itinerary struct {
+	StartDate     string         `json:"startDate"`
+	EndDate       string         `json:"endDate"`
+	Days          []ItineraryDay `json:"days"`
+	TotalCost     float64        `json:"totalCost"` // Sum of the lowest price of every activity
+	Unfilled      int            `json:"unfilled"`  // Slots no activity fitted
+	HolidayWindow *HolidayWindow `json:"holidayWindow,omitempty"`
+	Place         *Place         `json:"place,omitempty"`
+}
+
+// ItineraryDay is one day of an itinerary
+type ItineraryDay struct {
+	Date       string     `json:"date"`
+	Weekday    string     `json:"weekday"`
+	Activities []Activity `json:"activities"`
+}
+
+// ItineraryResponse is the JSON response of the itinerary endpoint
+type ItineraryResponse struct {
+	Success   bool       `json:"success"`
+	Itinerary *Itinerary `json:"itinerary,omitempty"`
+	Message   string     `json:"message,omitempty"`
+}
+
+// validate checks the constraints and maps categories onto the taxonomy
+func (c *ItineraryConstraints) validate() error {
+	if c.ActivitiesPerDay < 0 || c.ActivitiesPerDay > maxActivitiesPerDay {
+		return fmt.Errorf("constraints.activitiesPerDay must be between 1 and %d, or left out for %d", maxActivitiesPerDay, defaultActivitiesPerDay)
+	}
+	if c.Budget != nil && *c.Budget < 0 {
+		return fmt.Errorf("constraints.budget must not be negative")
+	}
+	if c.MaxTravelKm < 0 || c.MaxTravelKm > appConfig.Geo.MaxRadiusKm {
+		return fmt.Errorf("constraints.maxTravelKm must be between 0 and %g", appConfig.Geo.MaxRadiusKm)
+	}
+	for i, name := range c.Categories {
+		category, err := canonicalCategory(name)
+		if err != nil {
+			return err
+		}
+		c.Categories[i] = category
+	}
+	return nil
+}
+
+// handleItinerary plans activities for each day of a search's dates
+// (POST /v1/itinerary), as JSON or, with format=ics, as an iCalendar file
+func handleItinerary(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	format, err := responseFormat(r, formatJSON, formatICS)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var body ItineraryRequest
+	if status, err := decodeJSONBody(w, r, &body); err != nil {
+		logger.WarnContext(ctx, "Invalid request body", "error", err)
+		sendErrorResponse(w, status, err.Error())
+		return
+	}
+
+	constraints := body.Constraints
+	if err := constraints.validate(); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if constraints.ActivitiesPerDay == 0 {
+		constraints.ActivitiesPerDay = defaultActivitiesPerDay
+	}
+
+	// Search only for what the plan can use
+	search := body.Search
+	search.PageSize, search.PageToken = 0, ""
+	if len(constraints.Categories) > 0 {
+		if search.Filters == nil {
+			search.Filters = &SearchFilters{}
+		}
+		search.Filters.Categories = constraints.Categories
+	}
+	if constraints.MaxTravelKm > 0 && (search.RadiusKm == 0 || constraints.MaxTravelKm < search.RadiusKm) {
+		search.RadiusKm = constraints.MaxTravelKm
+	}
+	if err := search.validate(); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := search.resolvePlace(ctx); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := search.resolveHolidayWindow(time.Now()); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if search.DateRange == nil {
+		sendErrorResponse(w, http.StatusBadRequest, "dateRange is required unless location is in a region with known school holidays")
+		return
+	}
+
+	days := itineraryDays(*search.DateRange, constraints.WeekdaysOnly)
+	if len(days) == 0 {
+		sendErrorResponse(w, http.StatusBadRequest, "dateRange has no days to plan")
+		return
+	}
+	if len(days) > maxItineraryDays {
+		sendErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("An itinerary can cover at most %d days", maxItineraryDays))
+		return
+	}
+
+	// Refuse new plans once the daily token budget is used up
+	if err := dailyBudgetError(); err != nil {
+		sendSearchError(ctx, w, err)
+		return
+	}
+
+	logger.InfoContext(ctx, "Planning itinerary", "query", search.Query, "days", len(days),
+		"activitiesPerDay", constraints.ActivitiesPerDay)
+	ctx = withGroundingCollector(withUsageTracker(ctx))
+	candidates, err := gatherItineraryCandidates(ctx, &search, len(days)*constraints.ActivitiesPerDay)
+	if err != nil {
+		sendSearchError(ctx, w, err)
+		return
+	}
+	rankActivities(ctx, candidates, &search)
+
+	itinerary := planItinerary(days, candidates, constraints)
+	itinerary.HolidayWindow = search.holiday
+	itinerary.Place = search.place
+	logSearchUsage(ctx)
+
+	if format == formatICS {
+		events := make([]calendarEvent, 0, len(days)*constraints.ActivitiesPerDay)
+		for i, day := range itinerary.Days {
+			for _, activity := range day.Activities {
+				events = append(events, activityEvent(ctx, activity, days[i]))
+			}
+		}
+		writeCalendarResponse(w, r, "School holiday plan: "+search.Query, "itinerary.ics", events, 0)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ItineraryResponse{
+		Success:   true,
+		Itinerary: itinerary,
+		Message:   fmt.Sprintf("Planned %d of %d activities", len(days)*constraints.ActivitiesPerDay-itinerary.Unfilled, len(days)*constraints.ActivitiesPerDay),
+	})
+}
+
+// itineraryDays lists the days of dateRange to plan
+func itineraryDays(dateRange DateRange, weekdaysOnly bool) []time.Time {
+	start, startErr := time.Parse("2006-01-02", dateRange.StartDate)
+	end, endErr := time.Parse("2006-01-02", dateRange.EndDate)
+	if startErr != nil || endErr != nil {
+		return nil
+	}
+
+	var days []time.Time
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		if weekdaysOnly && (day.Weekday() == time.Saturday || day.Weekday() == time.Sunday) {
+			continue
+		}
+		days = append(days, day)
+		if len(days) > maxItineraryDays {
+			break // Enough to reject the request
+		}
+	}
+	return days
+}
+
+// gatherItineraryCandidates runs searches until they have found enough
+// activities to fill slots, each search excluding what earlier ones found.
+// It fails only when the first search does; later failures keep what was found.
+func gatherItineraryCandidates(ctx context.Context, req *SearchRequest, slots int) ([]Activity, error) {
+	var candidates []Activity
+	seen := make(map[string]bool)
+
+	for i := 0; i < maxItinerarySearches && len(candidates) < slots; i++ {
+		if i > 0 && appConfig.Budget.Action == budgetActionAbort {
+			if err := tokenBudgetError(ctx); err != nil {
+				logger.WarnContext(ctx, "Stopping itinerary searches", "error", err)
+				break
+			}
+		}
+
+		// Each search is a new conversation; only the excluded titles carry over
+		req.PageSize = min(slots-len(candidates), appConfig.Search.MaxPageSize)
+		req.history = nil
+		activities, err := performSearch(ctx, req)
+		if err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			logger.WarnContext(ctx, "Stopping itinerary searches", "error", err)
+			break
+		}
+		activities = req.Filters.apply(activities)
+
+		found := 0
+		for _, activity := range activities {
+			if seen[activity.ID] {
+				continue
+			}
+			seen[activity.ID] = true
+			candidates = append(candidates, activity)
+			req.excludeTitles = append(req.excludeTitles, activity.Title)
+			found++
+		}
+		if found == 0 {
+			break // Nothing new to find
+		}
+		if len(req.excludeTitles) > maxExcludedTitles {
+			req.excludeTitles = req.excludeTitles[len(req.excludeTitles)-maxExcludedTitles:]
+		}
+	}
+	return candidates, nil
+}
+
+// planItinerary fills each day from candidates, which are in order of preference.
+// An activity dated for a day is picked before undated ones, then the activity
+// whose category was used least; each activity is used once.
+func planItinerary(days []time.Time, candidates []Activity, constraints ItineraryConstraints) *Itinerary {
+	itinerary := &Itinerary{
+		StartDate: days[0].Format("2006-01-02"),
+		EndDate:   days[len(days)-1].Format("2006-01-02"),
+		Days:      make([]ItineraryDay, 0, len(days)),
+	}
+	used := make(map[string]bool)
+	categoryUse := make(map[string]int)
+
+	for _, day := range days {
+		date := day.Format("2006-01-02")
+		plan := ItineraryDay{Date: date, Weekday: day.Weekday().String(), Activities: []Activity{}}
+		dayCategories := make(map[string]bool)
+
+		for len(plan.Activities) < constraints.ActivitiesPerDay {
+			best := -1
+			for i, activity := range candidates {
+				if used[activity.ID] || dayCategories[activity.Category] || !constraints.fits(activity, date, itinerary.TotalCost) {
+					continue
+				}
+				if best < 0 || preferActivity(activity, candidates[best], date, categoryUse) {
+					best = i
+				}
+			}
+			if best < 0 {
+				itinerary.Unfilled += constraints.ActivitiesPerDay - len(plan.Activities)
+				break
+			}
+
+			activity := candidates[best]
+			used[activity.ID] = true
+			dayCategories[activity.Category] = true
+			categoryUse[activity.Category]++
+			if price, ok := parsePrice(activity.Price); ok {
+				itinerary.TotalCost += price
+			}
+			plan.Activities = append(plan.Activities, activity)
+		}
+		itinerary.Days = append(itinerary.Days, plan)
+	}
+	return itinerary
+}
+
+// fits reports whether an activity can go on date without breaking the constraints
+func (c ItineraryConstraints) fits(activity Activity, date string, spent float64) bool {
+	if activity.Date != "" && activity.Date != date {
+		return false
+	}
+	if c.Budget != nil {
+		price, ok := parsePrice(activity.Price)
+		if !ok || spent+price > *c.Budget {
+			return false
+		}
+	}
+	if c.MaxTravelKm > 0 && (activity.DistanceKm == nil || *activity.DistanceKm > c.MaxTravelKm) {
+		return false
+	}
+	return true
+}
+
+// preferActivity reports whether a is a better pick for date than b, the best so far
+func preferActivity(a, b Activity, date string, categoryUse map[string]int) bool {
+	aDated, bDated := a.Date == date, b.Date == date
+	if aDated != bDated {
+		return aDated
+	}
+	return categoryUse[a.Category] < categoryUse[b.Category]
+}
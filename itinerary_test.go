@@ -0,0 +1,180 @@
+package schoolsout
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// planTitles lists the titles planned for each day of an itinerary
+func planTitles(itinerary *Itinerary) [][]string {
+	titles := make([][]string, len(itinerary.Days))
+	for i, day := range itinerary.Days {
+		titles[i] = []string{}
+		for _, activity := range day.Activities {
+			titles[i] = append(titles[i], activity.Title)
+		}
+	}
+	return titles
+}
+
+func TestPlanItinerary(t *testing.T) {
+	days := []time.Time{
+		time.Date(2027, time.July, 5, 0, 0, 0, 0, time.UTC),
+		time.Date(2027, time.July, 6, 0, 0, 0, 0, time.UTC),
+	}
+	budget := func(amount float64) *float64 { return &amount }
+
+	tests := []struct {
+		name        string
+		candidates  []Activity
+		constraints ItineraryConstraints
+		want        [][]string
+		unfilled    int
+		totalCost   float64
+	}{
+		{
+			name: "dated activity before undated",
+			candidates: []Activity{
+				{ID: "1", Title: "Park", Category: "outdoors"},
+				{ID: "2", Title: "Show", Category: "arts", Date: "2027-07-06"},
+				{ID: "3", Title: "Zoo", Category: "animals"},
+			},
+			constraints: ItineraryConstraints{ActivitiesPerDay: 1},
+			want:        [][]string{{"Park"}, {"Show"}},
+		},
+		{
+			name: "activity dated for another day is skipped",
+			candidates: []Activity{
+				{ID: "1", Title: "Show", Category: "arts", Date: "2027-07-20"},
+				{ID: "2", Title: "Park", Category: "outdoors"},
+			},
+			constraints: ItineraryConstraints{ActivitiesPerDay: 1},
+			want:        [][]string{{"Park"}, {}},
+			unfilled:    1,
+		},
+		{
+			name: "categories mixed across and within days",
+			candidates: []Activity{
+				{ID: "1", Title: "Park", Category: "outdoors"},
+				{ID: "2", Title: "Beach", Category: "outdoors"},
+				{ID: "3", Title: "Museum", Category: "arts"},
+				{ID: "4", Title: "Gallery", Category: "arts"},
+			},
+			constraints: ItineraryConstraints{ActivitiesPerDay: 2},
+			want:        [][]string{{"Park", "Museum"}, {"Beach", "Gallery"}},
+		},
+		{
+			name: "least used category first",
+			candidates: []Activity{
+				{ID: "1", Title: "Park", Category: "outdoors"},
+				{ID: "2", Title: "Beach", Category: "outdoors"},
+				{ID: "3", Title: "Museum", Category: "arts"},
+			},
+			constraints: ItineraryConstraints{ActivitiesPerDay: 1},
+			want:        [][]string{{"Park"}, {"Museum"}},
+		},
+		{
+			name: "budget limits the plan",
+			candidates: []Activity{
+				{ID: "1", Title: "Zoo", Category: "animals", Price: "$30"},
+				{ID: "2", Title: "Cinema", Category: "arts", Price: "$25"},
+				{ID: "3", Title: "Park", Category: "outdoors", Price: "Free"},
+				{ID: "4", Title: "Show", Category: "events", Price: "Varies"},
+			},
+			constraints: ItineraryConstraints{ActivitiesPerDay: 1, Budget: budget(40)},
+			want:        [][]string{{"Zoo"}, {"Park"}},
+			totalCost:   30,
+		},
+		{
+			name:        "unfilled slots counted",
+			candidates:  []Activity{{ID: "1", Title: "Park", Category: "outdoors"}},
+			constraints: ItineraryConstraints{ActivitiesPerDay: 2},
+			want:        [][]string{{"Park"}, {}},
+			unfilled:    3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			itinerary := planItinerary(days, tt.candidates, tt.constraints)
+			if itinerary.StartDate != "2027-07-05" || itinerary.EndDate != "2027-07-06" {
+				t.Errorf("itinerary covers %s to %s", itinerary.StartDate, itinerary.EndDate)
+			}
+			if got := planTitles(itinerary); !slices.EqualFunc(got, tt.want, slices.Equal[[]string]) {
+				t.Errorf("planned %q, want %q", got, tt.want)
+			}
+			if itinerary.Unfilled != tt.unfilled {
+				t.Errorf("Unfilled = %d, want %d", itinerary.Unfilled, tt.unfilled)
+			}
+			if itinerary.TotalCost != tt.totalCost {
+				t.Errorf("TotalCost = %g, want %g", itinerary.TotalCost, tt.totalCost)
+			}
+		})
+	}
+}
+
+func TestItineraryConstraintsFits(t *testing.T) {
+	budget := 20.0
+	near, far := 5.0, 30.0
+	tests := []struct {
+		name        string
+		activity    Activity
+		constraints ItineraryConstraints
+		spent       float64
+		want        bool
+	}{
+		{"undated", Activity{}, ItineraryConstraints{}, 0, true},
+		{"dated for the day", Activity{Date: "2027-07-05"}, ItineraryConstraints{}, 0, true},
+		{"dated for another day", Activity{Date: "2027-07-06"}, ItineraryConstraints{}, 0, false},
+		{"within budget", Activity{Price: "$15"}, ItineraryConstraints{Budget: &budget}, 5, true},
+		{"over budget", Activity{Price: "$15"}, ItineraryConstraints{Budget: &budget}, 5.01, false},
+		{"free with the budget spent", Activity{Price: "Free entry"}, ItineraryConstraints{Budget: &budget}, 20, true},
+		{"unknown price with a budget", Activity{Price: "Varies"}, ItineraryConstraints{Budget: &budget}, 0, false},
+		{"unknown price without a budget", Activity{Price: "Varies"}, ItineraryConstraints{}, 0, true},
+		{"near enough", Activity{DistanceKm: &near}, ItineraryConstraints{MaxTravelKm: 10}, 0, true},
+		{"too far", Activity{DistanceKm: &far}, ItineraryConstraints{MaxTravelKm: 10}, 0, false},
+		{"unknown distance", Activity{}, ItineraryConstraints{MaxTravelKm: 10}, 0, false},
+	}
+	for _, tt := range tests {
+		if got := tt.constraints.fits(tt.activity, "2027-07-05", tt.spent); got != tt.want {
+			t.Errorf("%s: fits() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPreferActivity(t *testing.T) {
+	categoryUse := map[string]int{"outdoors": 2, "arts": 1}
+	tests := []struct {
+		name string
+		a, b Activity
+		want bool
+	}{
+		{"dated over undated", Activity{Date: "2027-07-05", Category: "outdoors"}, Activity{Category: "animals"}, true},
+		{"undated over dated", Activity{Category: "animals"}, Activity{Date: "2027-07-05", Category: "outdoors"}, false},
+		{"less used category", Activity{Category: "arts"}, Activity{Category: "outdoors"}, true},
+		{"unused category", Activity{Category: "animals"}, Activity{Category: "arts"}, true},
+		{"more used category", Activity{Category: "outdoors"}, Activity{Category: "arts"}, false},
+		{"tie keeps the earlier pick", Activity{Category: "arts"}, Activity{Category: "arts"}, false},
+	}
+	for _, tt := range tests {
+		if got := preferActivity(tt.a, tt.b, "2027-07-05", categoryUse); got != tt.want {
+			t.Errorf("%s: preferActivity() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestItineraryConstraintsValidate(t *testing.T) {
+	for _, perDay := range []int{0, 1, maxActivitiesPerDay} {
+		c := ItineraryConstraints{ActivitiesPerDay: perDay}
+		if err := c.validate(); err != nil {
+			t.Errorf("activitiesPerDay %d: validate() error = %v", perDay, err)
+		}
+	}
+	for _, perDay := range []int{-1, maxActivitiesPerDay + 1} {
+		c := ItineraryConstraints{ActivitiesPerDay: perDay}
+		if err := c.validate(); err == nil || !strings.Contains(err.Error(), "or left out") {
+			t.Errorf("activitiesPerDay %d: validate() error = %v", perDay, err)
+		}
+	}
+}
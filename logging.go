@@ -0,0 +1,231 @@
+package schoolsout
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Cloud Logging structured log field names
+// (see https://cloud.google.com/logging/docs/structured-logging)
+const (
+	logKeySeverity = "severity"
+	logKeyMessage  = "message"
+	logKeyTrace    = "logging.googleapis.com/trace"
+	logKeySpanID   = "logging.googleapis.com/spanId"
+	logKeyRequest  = "httpRequest"
+	logKeyReqID    = "requestId"
+)
+
+// logger is the structured logger used throughout the package
+var logger = newLogger(os.Stdout, appConfig)
+
+// newLogger creates a JSON logger whose output is understood by Cloud Logging
+func newLogger(w io.Writer, cfg *Config) *slog.Logger {
+	var handler slog.Handler = slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       cfg.Logging.slogLevel(),
+		ReplaceAttr: cloudLoggingAttr,
+	})
+	if cfg.Logging.Redact {
+		handler = &redactingHandler{Handler: handler}
+	}
+	return slog.New(&contextHandler{Handler: handler})
+}
+
+// cloudLoggingAttr renames the standard slog keys to the ones Cloud Logging recognises
+func cloudLoggingAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) > 0 {
+		return a
+	}
+	switch a.Key {
+	case slog.LevelKey:
+		a.Key = logKeySeverity
+		a.Value = slog.StringValue(cloudLoggingSeverity(a.Value.Any().(slog.Level)))
+	case slog.MessageKey:
+		a.Key = logKeyMessage
+	}
+	return a
+}
+
+// cloudLoggingSeverity maps a slog level to a Cloud Logging severity name
+func cloudLoggingSeverity(level slog.Level) string {
+	switch {
+	case level < slog.LevelInfo:
+		return "DEBUG"
+	case level < slog.LevelWarn:
+		return "INFO"
+	case level < slog.LevelError:
+		return "WARNING"
+	default:
+		return "ERROR"
+	}
+}
+
+// slogLevel parses the configured level name, defaulting to info
+func (c LoggingConfig) slogLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// contextHandler adds the request ID and trace from the context to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle implements slog.Handler
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	info, ok := ctx.Value(requestInfoKey{}).(*requestInfo)
+	if ok {
+		record.AddAttrs(slog.String(logKeyReqID, info.id))
+	}
+
+	// Prefer the active span so log entries nest under it in Cloud Trace
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		if projectID := gcpProjectID(); projectID != "" {
+			record.AddAttrs(slog.String(logKeyTrace, fmt.Sprintf("projects/%s/traces/%s", projectID, sc.TraceID())))
+		}
+		record.AddAttrs(slog.String(logKeySpanID, sc.SpanID().String()))
+	} else if ok {
+		if info.trace != "" {
+			record.AddAttrs(slog.String(logKeyTrace, info.trace))
+		}
+		if info.spanID != "" {
+			record.AddAttrs(slog.String(logKeySpanID, info.spanID))
+		}
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+// WithAttrs implements slog.Handler
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// requestInfoKey is the context key for requestInfo
+type requestInfoKey struct{}
+
+// requestInfo holds the per-request correlation identifiers
+type requestInfo struct {
+	id     string
+	trace  string // projects/{project}/traces/{traceId}
+	spanID string
+}
+
+// withRequestInfo returns a context carrying a correlation ID for the request.
+// The ID is taken from X-Request-ID or X-Cloud-Trace-Context if present, otherwise generated.
+func withRequestInfo(ctx context.Context, r *http.Request) context.Context {
+	info := &requestInfo{id: strings.TrimSpace(r.Header.Get("X-Request-ID"))}
+
+	// X-Cloud-Trace-Context: TRACE_ID/SPAN_ID;o=OPTIONS
+	if header := r.Header.Get("X-Cloud-Trace-Context"); header != "" {
+		traceID, rest, _ := strings.Cut(header, "/")
+		spanID, _, _ := strings.Cut(rest, ";")
+		if traceID != "" {
+			if projectID := gcpProjectID(); projectID != "" {
+				info.trace = fmt.Sprintf("projects/%s/traces/%s", projectID, traceID)
+			}
+			info.spanID = spanID
+			if info.id == "" {
+				info.id = traceID
+			}
+		}
+	}
+
+	if info.id == "" {
+		info.id = newRequestID()
+	}
+
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// requestIDFromContext returns the correlation ID of the request, or "" if there is none
+func requestIDFromContext(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// newRequestID generates a random correlation ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder captures the status code and size written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+// WriteHeader implements http.ResponseWriter
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
+
+// httpRequestAttr builds the Cloud Logging httpRequest field for a completed request.
+// The URL is logged without its query: GET search parameters carry locations and
+// other client text, which percent-encoding would hide from redaction.
+func httpRequestAttr(r *http.Request, rec *statusRecorder, latency time.Duration) slog.Attr {
+	status := rec.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return slog.Group(logKeyRequest,
+		slog.String("requestMethod", r.Method),
+		slog.String("requestUrl", r.URL.Path),
+		slog.Int("status", status),
+		slog.Int("responseSize", rec.size),
+		slog.String("userAgent", r.UserAgent()),
+		slog.String("remoteIp", getClientIP(r)),
+		slog.String("latency", fmt.Sprintf("%.9fs", latency.Seconds())),
+	)
+}
+
+// withRequestLogging assigns a correlation ID to each request, exposes it in the
+// X-Request-ID response header and logs the completed request with its httpRequest field
+func withRequestLogging(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx := withRequestInfo(r.Context(), r)
+		w.Header().Set("X-Request-ID", requestIDFromContext(ctx))
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r.WithContext(ctx))
+
+		logger.LogAttrs(ctx, slog.LevelInfo, "Request completed", httpRequestAttr(r, rec, time.Since(start)))
+	}
+}
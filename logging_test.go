@@ -0,0 +1,174 @@
+package schoolsout
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// logBuffer collects the output of the package logger
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Write implements io.Writer
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// entries decodes the JSON log lines written so far
+func (b *logBuffer) entries(t *testing.T) []map[string]any {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line is not JSON: %s", line)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// entry returns the first log entry with message, failing the test without one
+func (b *logBuffer) entry(t *testing.T, message string) map[string]any {
+	t.Helper()
+	for _, entry := range b.entries(t) {
+		if entry[logKeyMessage] == message {
+			return entry
+		}
+	}
+	t.Fatalf("no %q log entry", message)
+	return nil
+}
+
+// useLogBuffer sends the package logger's output to a buffer for the rest of the test
+func useLogBuffer(t *testing.T) *logBuffer {
+	t.Helper()
+	out := &logBuffer{}
+	previous := logger
+	logger = newLogger(out, appConfig)
+	t.Cleanup(func() { logger = previous })
+	return out
+}
+
+func TestRequestLoggingCorrelationFields(t *testing.T) {
+	const traceID = "105445aa7843bc8bf206b12000100000"
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "test-project")
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		id      string // Expected request ID; "" for a generated one
+		trace   string
+		spanID  string
+	}{
+		{
+			name:    "cloud trace header",
+			headers: map[string]string{"X-Cloud-Trace-Context": traceID + "/12345;o=1"},
+			id:      traceID,
+			trace:   "projects/test-project/traces/" + traceID,
+			spanID:  "12345",
+		},
+		{
+			name:    "request ID header wins",
+			headers: map[string]string{"X-Request-ID": "client-id", "X-Cloud-Trace-Context": traceID + "/12345"},
+			id:      "client-id",
+			trace:   "projects/test-project/traces/" + traceID,
+			spanID:  "12345",
+		},
+		{
+			name: "generated",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := useLogBuffer(t)
+			handler := withRequestLogging(func(w http.ResponseWriter, r *http.Request) {
+				logger.WarnContext(r.Context(), "Inside handler")
+				w.WriteHeader(http.StatusTeapot)
+			})
+			r := httptest.NewRequest(http.MethodGet, "/v1/search?q=zoo", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, r)
+
+			id := rec.Header().Get("X-Request-ID")
+			if tt.id != "" && id != tt.id {
+				t.Errorf("X-Request-ID = %q, want %q", id, tt.id)
+			}
+			if tt.id == "" && len(id) != 32 {
+				t.Errorf("generated X-Request-ID = %q, want 32 hex digits", id)
+			}
+
+			for _, message := range []string{"Inside handler", "Request completed"} {
+				entry := out.entry(t, message)
+				if entry[logKeyReqID] != id {
+					t.Errorf("%s: %s = %v, want %q", message, logKeyReqID, entry[logKeyReqID], id)
+				}
+				if trace, _ := entry[logKeyTrace].(string); trace != tt.trace {
+					t.Errorf("%s: %s = %q, want %q", message, logKeyTrace, trace, tt.trace)
+				}
+				if spanID, _ := entry[logKeySpanID].(string); spanID != tt.spanID {
+					t.Errorf("%s: %s = %q, want %q", message, logKeySpanID, spanID, tt.spanID)
+				}
+			}
+
+			if severity := out.entry(t, "Inside handler")[logKeySeverity]; severity != "WARNING" {
+				t.Errorf("%s = %v, want WARNING", logKeySeverity, severity)
+			}
+			request, _ := out.entry(t, "Request completed")[logKeyRequest].(map[string]any)
+			if request["status"] != float64(http.StatusTeapot) || request["requestUrl"] != "/v1/search" {
+				t.Errorf("%s = %v", logKeyRequest, request)
+			}
+		})
+	}
+}
+
+func TestRequestLoggingUsesActiveSpan(t *testing.T) {
+	recorder := useSpanRecorder(t)
+	out := useLogBuffer(t)
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "test-project")
+
+	r := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	r.Header.Set("X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	span := endedSpan(t, recorder, "GET /healthz").SpanContext()
+	entry := out.entry(t, "Request completed")
+	if want := "projects/test-project/traces/" + span.TraceID().String(); entry[logKeyTrace] != want {
+		t.Errorf("%s = %v, want %q", logKeyTrace, entry[logKeyTrace], want)
+	}
+	if entry[logKeySpanID] != span.SpanID().String() {
+		t.Errorf("%s = %v, want the handler span %s", logKeySpanID, entry[logKeySpanID], span.SpanID())
+	}
+}
+
+func TestLoggerLevel(t *testing.T) {
+	var out bytes.Buffer
+	log := newLogger(&out, &Config{Logging: LoggingConfig{Level: "warn"}})
+	log.Info("hidden")
+	log.Error("shown", slog.String("key", "value"))
+
+	if strings.Contains(out.String(), "hidden") {
+		t.Errorf("an info entry was logged at level warn: %s", out.String())
+	}
+	if !strings.Contains(out.String(), `"severity":"ERROR"`) || !strings.Contains(out.String(), `"message":"shown"`) {
+		t.Errorf("error entry = %s, want Cloud Logging severity and message keys", out.String())
+	}
+}
@@ -0,0 +1,230 @@
+package schoolsout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// Supported metrics exporters
+const (
+	metricsExporterNone       = "none"
+	metricsExporterStdout     = "stdout"
+	metricsExporterOTLP       = "otlp" // configured with the standard OTEL_EXPORTER_OTLP_* variables
+	metricsExporterPrometheus = "prometheus"
+)
+
+// instrumentationName identifies this package as the source of metrics and traces
+const instrumentationName = "github.com/davidpracilio/schoolsout-app-suggestions"
+
+// Pipeline stages used as the "stage" metric attribute
+const (
+	stageSearch   = "search"   // Stage 1: Google Search grounded search
+	stageConvert  = "convert"  // Stage 2: JSON conversion
+	stageRecovery = "recovery" // Stage 3: URL recovery
+)
+
+// searchMetrics holds the instruments for the search pipeline
+type searchMetrics struct {
+	requests           metric.Int64Counter
+	rateLimited        metric.Int64Counter
+	stageDuration      metric.Float64Histogram
+	geminiCalls        metric.Int64Counter
+	geminiErrors       metric.Int64Counter
+	activitiesReturned metric.Int64Histogram
+	urlRecovery        metric.Int64Counter
+	cacheLookups       metric.Int64Counter
+	tokens             metric.Int64Counter
+}
+
+var (
+	// promRegistry collects metrics for the Metrics endpoint when the prometheus exporter is used
+	promRegistry = prometheus.NewRegistry()
+
+	meterProvider = newMeterProvider(appConfig)
+	metrics       = newSearchMetrics(meterProvider.Meter(instrumentationName))
+)
+
+// newMeterProvider creates the meter provider for the configured exporter.
+// Misconfiguration falls back to a no-op provider so metrics never break searches.
+func newMeterProvider(cfg *Config) metric.MeterProvider {
+	var reader sdkmetric.Reader
+	interval := sdkmetric.WithInterval(time.Duration(cfg.Metrics.ExportInterval))
+
+	switch cfg.Metrics.Exporter {
+	case metricsExporterStdout:
+		exporter, err := stdoutmetric.New()
+		if err != nil {
+			logger.Error("Failed to create stdout metrics exporter", "error", err)
+			return noop.NewMeterProvider()
+		}
+		reader = sdkmetric.NewPeriodicReader(exporter, interval)
+	case metricsExporterOTLP:
+		exporter, err := otlpmetrichttp.New(context.Background())
+		if err != nil {
+			logger.Error("Failed to create OTLP metrics exporter", "error", err)
+			return noop.NewMeterProvider()
+		}
+		reader = sdkmetric.NewPeriodicReader(exporter, interval)
+	case metricsExporterPrometheus:
+		exporter, err := otelprometheus.New(otelprometheus.WithRegisterer(promRegistry))
+		if err != nil {
+			logger.Error("Failed to create Prometheus metrics exporter", "error", err)
+			return noop.NewMeterProvider()
+		}
+		reader = exporter
+	default:
+		return noop.NewMeterProvider()
+	}
+
+	return sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+}
+
+// newSearchMetrics creates the search pipeline instruments
+func newSearchMetrics(meter metric.Meter) *searchMetrics {
+	m := &searchMetrics{}
+	var errs []error
+	var err error
+
+	m.requests, err = meter.Int64Counter("schoolsout.requests",
+		metric.WithDescription("HTTP requests handled, by status code"))
+	errs = append(errs, err)
+	m.rateLimited, err = meter.Int64Counter("schoolsout.rate_limited",
+		metric.WithDescription("Requests rejected by the rate limiter"))
+	errs = append(errs, err)
+	m.stageDuration, err = meter.Float64Histogram("schoolsout.stage.duration",
+		metric.WithDescription("Duration of each search pipeline stage"),
+		metric.WithUnit("s"))
+	errs = append(errs, err)
+	m.geminiCalls, err = meter.Int64Counter("schoolsout.gemini.calls",
+		metric.WithDescription("Gemini API calls, by HTTP status code"))
+	errs = append(errs, err)
+	m.geminiErrors, err = meter.Int64Counter("schoolsout.gemini.errors",
+		metric.WithDescription("Failed Gemini API calls, by HTTP status code"))
+	errs = append(errs, err)
+	m.activitiesReturned, err = meter.Int64Histogram("schoolsout.activities.returned",
+		metric.WithDescription("Activities returned per search"))
+	errs = append(errs, err)
+	m.urlRecovery, err = meter.Int64Counter("schoolsout.url_recovery",
+		metric.WithDescription("Stage 3 URL recovery outcomes (recovered or missing)"))
+	errs = append(errs, err)
+	m.cacheLookups, err = meter.Int64Counter("schoolsout.cache.lookups",
+		metric.WithDescription("Cache lookups, by cache and result (hit or miss)"))
+	errs = append(errs, err)
+	m.tokens, err = meter.Int64Counter("schoolsout.gemini.tokens",
+		metric.WithDescription("Gemini tokens used, by type (prompt, candidates or tool_use)"))
+	errs = append(errs, err)
+
+	if err := errors.Join(errs...); err != nil {
+		logger.Error("Failed to create metric instruments", "error", err)
+	}
+	return m
+}
+
+// recordRequest counts a handled HTTP request
+func (m *searchMetrics) recordRequest(ctx context.Context, status int) {
+	m.requests.Add(ctx, 1, metric.WithAttributes(attribute.Int("status", status)))
+}
+
+// recordRateLimited counts a request rejected by the rate limiter
+func (m *searchMetrics) recordRateLimited(ctx context.Context) {
+	m.rateLimited.Add(ctx, 1)
+}
+
+// recordStage records how long a pipeline stage took
+func (m *searchMetrics) recordStage(ctx context.Context, stage string, start time.Time) {
+	m.stageDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attribute.String("stage", stage)))
+}
+
+// recordGeminiCall counts a Gemini API call. statusCode is 0 when no response was received.
+func (m *searchMetrics) recordGeminiCall(ctx context.Context, statusCode int, failed bool) {
+	attrs := metric.WithAttributes(attribute.String("status_code", geminiStatusLabel(statusCode)))
+	m.geminiCalls.Add(ctx, 1, attrs)
+	if failed {
+		m.geminiErrors.Add(ctx, 1, attrs)
+	}
+}
+
+// recordActivitiesReturned records the number of activities in a search response
+func (m *searchMetrics) recordActivitiesReturned(ctx context.Context, count int) {
+	m.activitiesReturned.Record(ctx, int64(count))
+}
+
+// recordURLRecovery records Stage 3 outcomes
+func (m *searchMetrics) recordURLRecovery(ctx context.Context, recovered, missing int) {
+	m.urlRecovery.Add(ctx, int64(recovered), metric.WithAttributes(attribute.String("result", "recovered")))
+	m.urlRecovery.Add(ctx, int64(missing), metric.WithAttributes(attribute.String("result", "missing")))
+}
+
+// recordCacheLookup counts a cache hit or miss for the named cache: credentials,
+// health, activities or forecast
+func (m *searchMetrics) recordCacheLookup(ctx context.Context, cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups.Add(ctx, 1, metric.WithAttributes(attribute.String("cache", cache), attribute.String("result", result)))
+}
+
+// recordTokens counts the tokens used by a Gemini call
+func (m *searchMetrics) recordTokens(ctx context.Context, usage UsageMetadata) {
+	m.tokens.Add(ctx, int64(usage.PromptTokenCount), metric.WithAttributes(attribute.String("type", "prompt")))
+	m.tokens.Add(ctx, int64(usage.CandidatesTokenCount), metric.WithAttributes(attribute.String("type", "candidates")))
+	m.tokens.Add(ctx, int64(usage.ToolUsePromptTokenCount), metric.WithAttributes(attribute.String("type", "tool_use")))
+}
+
+// geminiStatusLabel formats a Gemini status code for use as a metric attribute
+func geminiStatusLabel(statusCode int) string {
+	if statusCode == 0 {
+		return "transport_error"
+	}
+	return strconv.Itoa(statusCode)
+}
+
+// withRequestMetrics counts each request by its response status code
+func withRequestMetrics(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		metrics.recordRequest(r.Context(), status)
+	}
+}
+
+// Metrics is the Prometheus scrape endpoint, served at GET /metrics behind API
+// key authentication. It responds with 404 unless the prometheus metrics
+// exporter is configured.
+func Metrics(w http.ResponseWriter, r *http.Request) {
+	if appConfig.Metrics.Exporter != metricsExporterPrometheus {
+		w.Header().Set("Content-Type", "application/json")
+		sendErrorResponse(w, http.StatusNotFound, "Not found")
+		return
+	}
+	promhttp.HandlerFor(promRegistry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// validMetricsExporter reports whether name is a supported metrics exporter
+func validMetricsExporter(name string) error {
+	switch name {
+	case metricsExporterNone, metricsExporterStdout, metricsExporterOTLP, metricsExporterPrometheus:
+		return nil
+	}
+	return fmt.Errorf("metrics.exporter must be one of none, stdout, otlp or prometheus")
+}
@@ -0,0 +1,100 @@
+package schoolsout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Notifier backends
+const (
+	notifierLog  = "log"
+	notifierFile = "file"
+)
+
+// NewActivitiesEvent is emitted when a saved search finds activities it hasn't seen before
+type NewActivitiesEvent struct {
+	UserID        string        `json:"userId"`
+	SavedSearchID string        `json:"savedSearchId"`
+	Name          string        `json:"name"`
+	Search        SearchRequest `json:"search"`
+	Activities    []Activity    `json:"activities"`
+	FoundAt       time.Time     `json:"foundAt"`
+}
+
+// Notifier delivers new-activity alerts to users
+type Notifier interface {
+	Notify(ctx context.Context, event NewActivitiesEvent) error
+}
+
+// notifier delivers the alerts of RunSavedSearches
+var notifier = newNotifier(appConfig.Alerts)
+
+// newNotifier creates the notifier for the configured backend
+func newNotifier(cfg AlertsConfig) Notifier {
+	switch cfg.Notifier {
+	case notifierFile:
+		return &FileNotifier{Path: cfg.NotifierPath}
+	default:
+		return LogNotifier{}
+	}
+}
+
+// validNotifier reports whether name is a supported notifier
+func validNotifier(name string) error {
+	switch name {
+	case notifierLog, notifierFile:
+		return nil
+	}
+	return fmt.Errorf("alerts.notifier must be log or file")
+}
+
+// LogNotifier writes alerts to the structured log, where a log-based sink can pick them up
+type LogNotifier struct{}
+
+// Notify implements Notifier
+func (LogNotifier) Notify(ctx context.Context, event NewActivitiesEvent) error {
+	titles := make([]string, 0, len(event.Activities))
+	for _, activity := range event.Activities {
+		titles = append(titles, activity.Title)
+	}
+	logger.InfoContext(ctx, "New activities found",
+		"userId", event.UserID,
+		"savedSearchId", event.SavedSearchID,
+		"name", event.Name,
+		"count", len(event.Activities),
+		"titles", titles)
+	return nil
+}
+
+// FileNotifier appends each alert as a JSON line to a file
+type FileNotifier struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Notify implements Notifier
+func (n *FileNotifier) Notify(ctx context.Context, event NewActivitiesEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open notification file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write notification: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package schoolsout
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxExcludedTitles bounds how many earlier activities are listed in a later page's prompt
+const maxExcludedTitles = 50
+
+// searchSession remembers what a paginated search has returned so far
+type searchSession struct {
+	fingerprint string   // Identifies the search, so a token can't be replayed against another one
+	pageSize    int      // Page size of the latest page, used when a request only sends a token
+	titles      []string // In the order they were returned
+	seenTitles  map[string]bool
+	seenURLs    map[string]bool
+	expires     time.Time
+}
+
+// searchSessionStore holds the sessions of paginated searches.
+// Sessions live in this instance's memory, so a page token only works on the
+// instance that issued it and is lost when the instance is recycled.
+type searchSessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*searchSession
+}
+
+// searchSessions is the per-instance store of paginated searches
+var searchSessions = &searchSessionStore{sessions: make(map[string]*searchSession)}
+
+// paginated reports whether the client asked for paged results
+func (req *SearchRequest) paginated() bool {
+	return req.PageSize > 0 || req.PageToken != ""
+}
+
+// resume looks up the session behind a page token, checks that it belongs to
+// req and prepares req to search for the next page
+func (s *searchSessionStore) resume(token string, req *SearchRequest) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", fmt.Errorf("pageToken is invalid or has expired")
+	}
+	id := string(raw)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	if !ok || time.Now().After(session.expires) {
+		delete(s.sessions, id)
+		return "", fmt.Errorf("pageToken is invalid or has expired")
+	}
+	if req.PageSize == 0 {
+		req.PageSize = session.pageSize
+	}
+	if searchFingerprint(req) != session.fingerprint {
+		return "", fmt.Errorf("pageToken does not belong to this search")
+	}
+
+	titles := session.titles
+	if len(titles) > maxExcludedTitles {
+		titles = titles[len(titles)-maxExcludedTitles:]
+	}
+	req.excludeTitles = append([]string(nil), titles...)
+	return id, nil
+}
+
+// record drops activities the session has already returned, trims the page to
+// req.PageSize and remembers what is left. It returns the page and the token for
+// the next one, which is empty once a page brings nothing new.
+func (s *searchSessionStore) record(id string, req *SearchRequest, activities []Activity) ([]Activity, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	session, ok := s.sessions[id]
+	if !ok {
+		s.prune(now)
+		id = newRequestID()
+		session = &searchSession{
+			fingerprint: searchFingerprint(req),
+			seenTitles:  make(map[string]bool),
+			seenURLs:    make(map[string]bool),
+		}
+		s.sessions[id] = session
+	}
+	session.pageSize = req.PageSize
+	session.expires = now.Add(time.Duration(appConfig.Search.SessionTTL))
+
+	page := make([]Activity, 0, len(activities))
+	for _, activity := range activities {
+		if len(page) == session.pageSize {
+			break
+		}
+		title := normalizeTitle(activity.Title)
+		url := normalizeURL(activity.BookingURL)
+		if session.seenTitles[title] || (url != "" && session.seenURLs[url]) {
+			continue
+		}
+		session.seenTitles[title] = true
+		if url != "" {
+			session.seenURLs[url] = true
+		}
+		session.titles = append(session.titles, activity.Title)
+		page = append(page, activity)
+	}
+
+	if len(page) == 0 {
+		delete(s.sessions, id)
+		return page, ""
+	}
+	return page, base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+// prune removes expired sessions. Caller must hold s.mu.
+func (s *searchSessionStore) prune(now time.Time) {
+	for id, session := range s.sessions {
+		if now.After(session.expires) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+// searchFingerprint identifies the search a page belongs to. The page size is
+// left out so a client may change it between pages, and so are dates taken from
+// the holiday calendar, so a token outlives the start of the next holidays.
+func searchFingerprint(req *SearchRequest) string {
+	values := req.queryValues()
+	values.Del(queryParamPageSize)
+	if req.holiday != nil {
+		values.Del(queryParamFrom)
+		values.Del(queryParamTo)
+	}
+	return values.Encode()
+}
+
+// normalizeURL drops case, the trailing slash and surrounding space from a URL
+func normalizeURL(url string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(url)), "/")
+}
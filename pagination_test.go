@@ -0,0 +1,166 @@
+package schoolsout
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSearchSessionPages(t *testing.T) {
+	store := &searchSessionStore{sessions: make(map[string]*searchSession)}
+	req := &SearchRequest{Query: "zoo", PageSize: 2}
+	activities := []Activity{
+		{Title: "Zoo day", BookingURL: "https://zoo.example/day"},
+		{Title: "zoo  DAY!"},
+		{Title: "Night zoo", BookingURL: "https://zoo.example/day/"},
+		{Title: "Aquarium"},
+		{Title: "Museum"},
+	}
+
+	page, token := store.record("", req, activities)
+	if got := activityTitles(page); got != "Zoo day|Aquarium" {
+		t.Errorf("first page = %s, want duplicates by title and URL dropped", got)
+	}
+	if token == "" {
+		t.Fatal("first page has no next page token")
+	}
+
+	// A token alone keeps the page size and excludes what was returned
+	next := &SearchRequest{Query: "zoo", PageToken: token}
+	id, err := store.resume(token, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.PageSize != 2 {
+		t.Errorf("resumed PageSize = %d, want 2", next.PageSize)
+	}
+	if got := strings.Join(next.excludeTitles, "|"); got != "Zoo day|Aquarium" {
+		t.Errorf("excludeTitles = %s", got)
+	}
+
+	page, token = store.record(id, next, activities)
+	if got := activityTitles(page); got != "Museum" {
+		t.Errorf("second page = %s, want only the new activity", got)
+	}
+	page, token = store.record(id, next, activities)
+	if len(page) != 0 || token != "" {
+		t.Errorf("a page with nothing new = %s with token %q, want empty and no token", activityTitles(page), token)
+	}
+	if _, err := store.resume(base64.RawURLEncoding.EncodeToString([]byte(id)), next); err == nil {
+		t.Error("the session outlived a page with nothing new")
+	}
+}
+
+// activityTitles joins the titles of activities, for comparing pages
+func activityTitles(activities []Activity) string {
+	titles := make([]string, len(activities))
+	for i, activity := range activities {
+		titles[i] = activity.Title
+	}
+	return strings.Join(titles, "|")
+}
+
+func TestSearchSessionResumeErrors(t *testing.T) {
+	store := &searchSessionStore{sessions: make(map[string]*searchSession)}
+	_, token := store.record("", &SearchRequest{Query: "zoo", Location: "Perth", PageSize: 1}, []Activity{{Title: "Zoo day"}})
+
+	tests := []struct {
+		name  string
+		token string
+		req   SearchRequest
+		want  string
+	}{
+		{"not base64", "!!", SearchRequest{Query: "zoo", Location: "Perth"}, "invalid or has expired"},
+		{"unknown session", base64.RawURLEncoding.EncodeToString([]byte("nope")), SearchRequest{Query: "zoo", Location: "Perth"}, "invalid or has expired"},
+		{"another query", token, SearchRequest{Query: "museums", Location: "Perth"}, "does not belong"},
+		{"another location", token, SearchRequest{Query: "zoo", Location: "Sydney"}, "does not belong"},
+		{"dates added", token, SearchRequest{Query: "zoo", Location: "Perth", DateRange: &DateRange{StartDate: "2027-07-03", EndDate: "2027-07-18"}}, "does not belong"},
+		{"another page size", token, SearchRequest{Query: "zoo", Location: "Perth", PageSize: 5}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := store.resume(tt.token, &tt.req)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("resume() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("resume() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchSessionCapsExcludedTitles(t *testing.T) {
+	store := &searchSessionStore{sessions: make(map[string]*searchSession)}
+	req := &SearchRequest{Query: "zoo", PageSize: maxExcludedTitles + 10}
+	activities := make([]Activity, maxExcludedTitles+10)
+	for i := range activities {
+		activities[i].Title = fmt.Sprintf("Activity %d", i)
+	}
+	_, token := store.record("", req, activities)
+
+	next := &SearchRequest{Query: "zoo"}
+	if _, err := store.resume(token, next); err != nil {
+		t.Fatal(err)
+	}
+	if len(next.excludeTitles) != maxExcludedTitles || next.excludeTitles[0] != "Activity 10" {
+		t.Errorf("excludeTitles holds %d titles from %q, want the latest %d", len(next.excludeTitles), next.excludeTitles[0], maxExcludedTitles)
+	}
+}
+
+func TestSearchFingerprintIgnoresHolidayDates(t *testing.T) {
+	july := &HolidayWindow{StartDate: "2027-07-03", EndDate: "2027-07-18"}
+	october := &HolidayWindow{StartDate: "2027-09-25", EndDate: "2027-10-10"}
+	first := &SearchRequest{Query: "zoo", Location: "Perth", holiday: july,
+		DateRange: &DateRange{StartDate: july.StartDate, EndDate: july.EndDate}}
+	later := &SearchRequest{Query: "zoo", Location: "Perth", holiday: october,
+		DateRange: &DateRange{StartDate: october.StartDate, EndDate: october.EndDate}}
+	if searchFingerprint(first) != searchFingerprint(later) {
+		t.Error("the next holidays starting between pages changed the fingerprint")
+	}
+
+	given := &SearchRequest{Query: "zoo", Location: "Perth",
+		DateRange: &DateRange{StartDate: october.StartDate, EndDate: october.EndDate}}
+	if searchFingerprint(first) == searchFingerprint(given) {
+		t.Error("dates the client gave are left out of the fingerprint")
+	}
+}
+
+func TestPaginatedSearch(t *testing.T) {
+	gemini := useFakeGemini(t, Activity{Title: "Zoo day"}, Activity{Title: "Aquarium"})
+	body := SearchRequest{Query: "zoo", Location: "Perth", PageSize: 1}
+
+	status, first := postJSON(t, "/v1/search", body)
+	if status != http.StatusOK || len(first.Activities) != 1 || first.NextPageToken == "" {
+		t.Fatalf("first page = %d %+v, want one activity and a token", status, first)
+	}
+	if first.SearchID != "" {
+		t.Error("a paginated search can be refined")
+	}
+
+	status, second := postJSON(t, "/v1/search", SearchRequest{Query: "zoo", Location: "Perth", PageToken: first.NextPageToken})
+	if status != http.StatusOK || len(second.Activities) != 1 || second.Activities[0].Title == first.Activities[0].Title {
+		t.Fatalf("second page = %d %+v, want the other activity", status, second)
+	}
+
+	// The last search prompt, not a later one recovering booking URLs
+	var prompt string
+	for _, search := range gemini.searchRequests() {
+		if text := search.Contents[0].Parts[0].Text; strings.HasPrefix(text, "Search for ") {
+			prompt = text
+		}
+	}
+	if !strings.Contains(prompt, "- "+first.Activities[0].Title+"\n") {
+		t.Errorf("second page prompt doesn't exclude %q:\n%s", first.Activities[0].Title, prompt)
+	}
+
+	status, _ = postJSON(t, "/v1/search", SearchRequest{Query: "museums", Location: "Perth", PageToken: second.NextPageToken})
+	if status != http.StatusBadRequest {
+		t.Errorf("token of another search = %d, want 400", status)
+	}
+}
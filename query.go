@@ -0,0 +1,282 @@
+package schoolsout
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query-string parameters accepted by GET searches
+const (
+	queryParamQuery    = "q"
+	queryParamLocation = "location"
+	queryParamMinAge   = "minAge"
+	queryParamMaxAge   = "maxAge"
+	queryParamFrom     = "from"
+	queryParamTo       = "to"
+	queryParamDebug    = "debug"
+	queryParamPageSize = "pageSize"
+	queryParamToken    = "pageToken"
+	queryParamRadius   = "radiusKm"
+	queryParamSort     = "sort"
+	queryParamCategory = "category"
+	queryParamMaxPrice = "maxPrice"
+	queryParamFree     = "free"
+	queryParamUnknown  = "unknownPrice"
+	queryParamSetting  = "setting"
+	queryParamAccess   = "accessible"
+	queryParamFormat   = "format" // Also accepted by endpoints that render other formats
+)
+
+// Defaults used when only one end of an age range is given in a query string
+const (
+	defaultMinAge = 0
+	defaultMaxAge = 18
+)
+
+// searchRequestFromQuery maps GET query-string parameters onto a SearchRequest:
+// ?q=...&location=...&minAge=...&maxAge=...&from=yyyy-MM-dd&to=yyyy-MM-dd
+func searchRequestFromQuery(values url.Values) (SearchRequest, error) {
+	req := SearchRequest{
+		Query:    strings.TrimSpace(values.Get(queryParamQuery)),
+		Location: strings.TrimSpace(values.Get(queryParamLocation)),
+	}
+
+	minAgeText := strings.TrimSpace(values.Get(queryParamMinAge))
+	maxAgeText := strings.TrimSpace(values.Get(queryParamMaxAge))
+	if minAgeText != "" || maxAgeText != "" {
+		ageRange := &AgeRange{Min: defaultMinAge, Max: defaultMaxAge}
+		if minAgeText != "" {
+			minAge, err := strconv.Atoi(minAgeText)
+			if err != nil || minAge < 0 {
+				return req, fmt.Errorf("%s must be a non-negative whole number", queryParamMinAge)
+			}
+			ageRange.Min = minAge
+		}
+		if maxAgeText != "" {
+			maxAge, err := strconv.Atoi(maxAgeText)
+			if err != nil || maxAge < 0 {
+				return req, fmt.Errorf("%s must be a non-negative whole number", queryParamMaxAge)
+			}
+			ageRange.Max = maxAge
+		}
+		if ageRange.Min > ageRange.Max {
+			return req, fmt.Errorf("%s must not be greater than %s", queryParamMinAge, queryParamMaxAge)
+		}
+		req.AgeRange = ageRange
+	}
+
+	from := strings.TrimSpace(values.Get(queryParamFrom))
+	to := strings.TrimSpace(values.Get(queryParamTo))
+	if from != "" || to != "" {
+		if from == "" {
+			from = to
+		}
+		if to == "" {
+			to = from
+		}
+		for name, value := range map[string]string{queryParamFrom: from, queryParamTo: to} {
+			if _, err := time.Parse("2006-01-02", value); err != nil {
+				return req, fmt.Errorf("%s must be a date in yyyy-MM-dd format", name)
+			}
+		}
+		if to < from {
+			return req, fmt.Errorf("%s must not be before %s", queryParamTo, queryParamFrom)
+		}
+		req.DateRange = &DateRange{StartDate: from, EndDate: to}
+	}
+
+	if pageSize := strings.TrimSpace(values.Get(queryParamPageSize)); pageSize != "" {
+		size, err := strconv.Atoi(pageSize)
+		if err != nil || size <= 0 {
+			return req, fmt.Errorf("%s must be a positive whole number", queryParamPageSize)
+		}
+		req.PageSize = size
+	}
+	req.PageToken = strings.TrimSpace(values.Get(queryParamToken))
+
+	if radius := strings.TrimSpace(values.Get(queryParamRadius)); radius != "" {
+		radiusKm, err := strconv.ParseFloat(radius, 64)
+		if err != nil || radiusKm <= 0 {
+			return req, fmt.Errorf("%s must be a positive number", queryParamRadius)
+		}
+		req.RadiusKm = radiusKm
+	}
+
+	req.Sort = strings.TrimSpace(values.Get(queryParamSort))
+
+	filters, err := searchFiltersFromQuery(values)
+	if err != nil {
+		return req, err
+	}
+	if !filters.empty() {
+		req.Filters = filters
+	}
+
+	if debug := values.Get(queryParamDebug); debug != "" {
+		req.Debug, _ = strconv.ParseBool(debug)
+	}
+
+	return req, nil
+}
+
+// searchFiltersFromQuery reads ?category=Arts,Sports&maxPrice=20&free=true&unknownPrice=true&setting=indoor&accessible=true
+func searchFiltersFromQuery(values url.Values) (*SearchFilters, error) {
+	filters := &SearchFilters{Setting: strings.TrimSpace(values.Get(queryParamSetting))}
+
+	for _, value := range values[queryParamCategory] {
+		for _, category := range strings.Split(value, ",") {
+			if category = strings.TrimSpace(category); category != "" {
+				filters.Categories = append(filters.Categories, category)
+			}
+		}
+	}
+	if maxPrice := strings.TrimSpace(values.Get(queryParamMaxPrice)); maxPrice != "" {
+		price, err := strconv.ParseFloat(maxPrice, 64)
+		if err != nil || price < 0 {
+			return nil, fmt.Errorf("%s must be a non-negative number", queryParamMaxPrice)
+		}
+		filters.MaxPrice = &price
+	}
+	for name, dst := range map[string]*bool{
+		queryParamFree:    &filters.FreeOnly,
+		queryParamUnknown: &filters.IncludeUnknownPrice,
+		queryParamAccess:  &filters.Accessible,
+	} {
+		if value := strings.TrimSpace(values.Get(name)); value != "" {
+			flag, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be true or false", name)
+			}
+			*dst = flag
+		}
+	}
+	return filters, nil
+}
+
+// queryValues is the inverse of searchRequestFromQuery, used to build shareable URLs.
+// The page token is left out: a shared link starts the search from the first page.
+func (req *SearchRequest) queryValues() url.Values {
+	values := url.Values{}
+	values.Set(queryParamQuery, req.Query)
+	if req.Location != "" {
+		values.Set(queryParamLocation, req.Location)
+	}
+	if req.AgeRange != nil {
+		values.Set(queryParamMinAge, strconv.Itoa(req.AgeRange.Min))
+		values.Set(queryParamMaxAge, strconv.Itoa(req.AgeRange.Max))
+	}
+	if req.DateRange != nil {
+		values.Set(queryParamFrom, req.DateRange.StartDate)
+		values.Set(queryParamTo, req.DateRange.EndDate)
+	}
+	if req.RadiusKm > 0 {
+		values.Set(queryParamRadius, strconv.FormatFloat(req.RadiusKm, 'f', -1, 64))
+	}
+	if req.Sort != "" {
+		values.Set(queryParamSort, req.Sort)
+	}
+	if f := req.Filters; !f.empty() {
+		if len(f.Categories) > 0 {
+			values.Set(queryParamCategory, strings.Join(f.Categories, ","))
+		}
+		if f.MaxPrice != nil {
+			values.Set(queryParamMaxPrice, strconv.FormatFloat(*f.MaxPrice, 'f', -1, 64))
+		}
+		if f.FreeOnly {
+			values.Set(queryParamFree, "true")
+		}
+		if f.IncludeUnknownPrice {
+			values.Set(queryParamUnknown, "true")
+		}
+		if f.Setting != "" {
+			values.Set(queryParamSetting, f.Setting)
+		}
+		if f.Accessible {
+			values.Set(queryParamAccess, "true")
+		}
+	}
+	if req.PageSize > 0 {
+		values.Set(queryParamPageSize, strconv.Itoa(req.PageSize))
+	}
+	return values
+}
+
+// shareURL returns a GET URL that repeats the search, so results can be linked and
+// shared. It starts with search.publicBaseUrl rather than the request's Host and
+// X-Forwarded-Proto headers, which a client controls; without it there is none.
+func shareURL(req *SearchRequest) string {
+	if appConfig.Search.PublicBaseURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(appConfig.Search.PublicBaseURL, "/") + "/v1/search?" + req.queryValues().Encode()
+}
+
+// writeCacheableJSON writes v as JSON with an ETag and Cache-Control header,
+// answering 304 Not Modified when the client already holds the same representation.
+// A zero maxAge asks caches to revalidate on every use.
+func writeCacheableJSON(w http.ResponseWriter, r *http.Request, v any, maxAge time.Duration) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Failed to encode response", "error", err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to encode response")
+		return
+	}
+	writeCacheable(w, r, append(body, '\n'), maxAge)
+}
+
+// writeCacheable writes a response body, already rendered in the Content-Type set
+// on w, with an ETag and Cache-Control, answering 304 when the client's copy is current.
+// The ETag hashes the finished body, so a 304 saves the transfer but not the work,
+// Gemini calls included, that produced it; max-age is what lets caches skip a search.
+func writeCacheable(w http.ResponseWriter, r *http.Request, body []byte, maxAge time.Duration) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	switch {
+	case maxAge <= 0:
+		w.Header().Set("Cache-Control", "no-cache")
+	case privateResponse(r):
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(maxAge.Seconds())))
+	default:
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	}
+	w.Header().Set("Vary", "Accept, Origin, Authorization, X-API-Key")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// privateResponse reports whether a response may only be kept by the client's own
+// cache: when keys are required, so a shared cache can't serve it without one, or
+// when debug details were asked for
+func privateResponse(r *http.Request) bool {
+	if len(appConfig.Auth.APIKeys) > 0 || requestAPIKey(r) != "" {
+		return true
+	}
+	debug, _ := strconv.ParseBool(r.URL.Query().Get(queryParamDebug))
+	return debug
+}
+
+// etagMatches reports whether an If-None-Match header matches etag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
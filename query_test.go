@@ -0,0 +1,76 @@
+package schoolsout
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWriteCacheableHeaders(t *testing.T) {
+	apiKeys := appConfig.Auth.APIKeys
+	t.Cleanup(func() { appConfig.Auth.APIKeys = apiKeys })
+
+	tests := []struct {
+		name         string
+		apiKeys      []string
+		target       string
+		key          string
+		maxAge       time.Duration
+		cacheControl string
+	}{
+		{"public", nil, "/v1/search?q=zoo", "", time.Minute, "public, max-age=60"},
+		{"no max-age", nil, "/v1/search?q=zoo", "", 0, "no-cache"},
+		{"keys required", []string{"client-key"}, "/v1/search?q=zoo", "client-key", time.Minute, "private, max-age=60"},
+		{"key sent", nil, "/v1/search?q=zoo", "alice-key", time.Minute, "private, max-age=60"},
+		{"debug", nil, "/v1/search?q=zoo&debug=true", "", time.Minute, "private, max-age=60"},
+		{"debug off", nil, "/v1/search?q=zoo&debug=false", "", time.Minute, "public, max-age=60"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appConfig.Auth.APIKeys = tt.apiKeys
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+			rec := httptest.NewRecorder()
+			writeCacheable(rec, req, []byte("{}\n"), tt.maxAge)
+			if got := rec.Header().Get("Cache-Control"); got != tt.cacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.cacheControl)
+			}
+			if got, want := rec.Header().Get("Vary"), "Accept, Origin, Authorization, X-API-Key"; got != want {
+				t.Errorf("Vary = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestWriteCacheableNotModified(t *testing.T) {
+	first := httptest.NewRecorder()
+	writeCacheable(first, httptest.NewRequest(http.MethodGet, "/v1/search?q=zoo", nil), []byte("{}\n"), time.Minute)
+	etag := first.Header().Get("ETag")
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/search?q=zoo", nil)
+	req.Header.Set("If-None-Match", `W/"other", `+etag)
+	rec := httptest.NewRecorder()
+	writeCacheable(rec, req, []byte("{}\n"), time.Minute)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("status = %d, body %q; want 304 and no body", rec.Code, rec.Body)
+	}
+}
+
+func TestShareURLUsesPublicBaseURL(t *testing.T) {
+	baseURL := appConfig.Search.PublicBaseURL
+	t.Cleanup(func() { appConfig.Search.PublicBaseURL = baseURL })
+	req := &SearchRequest{Query: "zoo", Location: "Sydney"}
+
+	appConfig.Search.PublicBaseURL = ""
+	if got := shareURL(req); got != "" {
+		t.Errorf("without a public base URL shareURL = %q, want none", got)
+	}
+
+	appConfig.Search.PublicBaseURL = "https://api.example.com/"
+	if got, want := shareURL(req), "https://api.example.com/v1/search?location=Sydney&q=zoo"; got != want {
+		t.Errorf("shareURL = %q, want %q", got, want)
+	}
+}
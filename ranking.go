@@ -0,0 +1,317 @@
+package schoolsout
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sort orders accepted in SearchRequest.Sort
+const (
+	sortRelevance = "relevance"
+	sortPrice     = "price"
+	sortDate      = "date"
+	sortDistance  = "distance"
+)
+
+// Weights of the ranking signals in an activity's relevance score; they sum to 1
+const (
+	weightAgeFit    = 0.25
+	weightDateFit   = 0.15
+	weightDistance  = 0.15
+	weightPrice     = 0.10
+	weightURL       = 0.15
+	weightGrounding = 0.10
+	weightWeather   = 0.10
+)
+
+// unknownScore is given to a signal that can't be judged, so it neither helps nor hurts
+const unknownScore = 0.5
+
+// ActivityScore is the relevance score of an activity and the signals it is made of,
+// each between 0 and 1
+type ActivityScore struct {
+	Total     float64 `json:"total"`
+	AgeFit    float64 `json:"ageFit"`
+	DateFit   float64 `json:"dateFit"`
+	Distance  float64 `json:"distance"`
+	Price     float64 `json:"price"`
+	URL       float64 `json:"url"`
+	Grounding float64 `json:"grounding"`
+	Weather   float64 `json:"weather"`
+}
+
+// validSort reports whether name is a supported sort order
+func validSort(name string) error {
+	switch name {
+	case "", sortRelevance, sortPrice, sortDate, sortDistance:
+		return nil
+	}
+	return fmt.Errorf("sort must be one of relevance, price, date or distance")
+}
+
+// rankActivities scores every activity and orders them by req.Sort. Without a
+// sort, radius searches are ordered by distance and others by relevance. It
+// returns the scores by activity ID.
+func rankActivities(ctx context.Context, activities []Activity, req *SearchRequest) map[string]ActivityScore {
+	scores := make(map[string]ActivityScore, len(activities))
+	for _, activity := range activities {
+		scores[activity.ID] = scoreActivity(ctx, activity, req)
+	}
+
+	order := req.Sort
+	if order == "" {
+		order = sortRelevance
+		if req.RadiusKm > 0 {
+			order = sortDistance
+		}
+	}
+
+	switch order {
+	case sortPrice:
+		sortByKnown(activities, func(a Activity) (float64, bool) { return parsePrice(a.Price) })
+	case sortDate:
+		sortByKnown(activities, func(a Activity) (float64, bool) {
+			date, err := time.Parse("2006-01-02", a.Date)
+			return float64(date.Unix()), err == nil
+		})
+	case sortDistance:
+		sortByKnown(activities, func(a Activity) (float64, bool) {
+			if a.DistanceKm == nil {
+				return 0, false
+			}
+			return *a.DistanceKm, true
+		})
+	default:
+		sort.SliceStable(activities, func(i, j int) bool {
+			return scores[activities[i].ID].Total > scores[activities[j].ID].Total
+		})
+	}
+
+	return scores
+}
+
+// sortByKnown sorts activities by ascending key, with activities whose key is unknown last
+func sortByKnown(activities []Activity, key func(Activity) (float64, bool)) {
+	sort.SliceStable(activities, func(i, j int) bool {
+		a, aKnown := key(activities[i])
+		b, bKnown := key(activities[j])
+		if !aKnown || !bKnown {
+			return aKnown && !bKnown
+		}
+		return a < b
+	})
+}
+
+// scoreActivity combines the ranking signals of one activity
+func scoreActivity(ctx context.Context, activity Activity, req *SearchRequest) ActivityScore {
+	score := ActivityScore{
+		AgeFit:    ageFit(activity, req),
+		DateFit:   dateFit(activity, req),
+		Distance:  distanceScore(activity, req),
+		Price:     priceScore(activity),
+		URL:       urlScore(activity),
+		Grounding: groundingScore(ctx, activity),
+		Weather:   weatherScore(activity, req),
+	}
+	score.Total = roundScore(weightAgeFit*score.AgeFit +
+		weightDateFit*score.DateFit +
+		weightDistance*score.Distance +
+		weightPrice*score.Price +
+		weightURL*score.URL +
+		weightGrounding*score.Grounding +
+		weightWeather*score.Weather)
+	return score
+}
+
+// ageFit is the share of the requested age range the activity caters for
+func ageFit(activity Activity, req *SearchRequest) float64 {
+	if req.AgeRange == nil {
+		return unknownScore
+	}
+	minAge, maxAge, ok := parseAgeRange(activity.AgeRange)
+	if !ok {
+		return unknownScore
+	}
+	overlap := min(maxAge, req.AgeRange.Max) - max(minAge, req.AgeRange.Min) + 1
+	if overlap <= 0 {
+		return 0
+	}
+	return roundScore(float64(overlap) / float64(req.AgeRange.Max-req.AgeRange.Min+1))
+}
+
+// ageNumbers finds the ages mentioned in an activity's age range
+var ageNumbers = regexp.MustCompile(`\d+`)
+
+// parseAgeRange reads ranges such as "6-12 years", "5+" and "All ages"
+func parseAgeRange(text string) (int, int, bool) {
+	text = strings.ToLower(text)
+	if strings.Contains(text, "all ages") {
+		return 0, defaultMaxAge, true
+	}
+	numbers := ageNumbers.FindAllString(text, 2)
+	switch len(numbers) {
+	case 2:
+		minAge, _ := strconv.Atoi(numbers[0])
+		maxAge, _ := strconv.Atoi(numbers[1])
+		return min(minAge, maxAge), max(minAge, maxAge), true
+	case 1:
+		age, _ := strconv.Atoi(numbers[0])
+		switch {
+		case strings.Contains(text, "+"), strings.Contains(text, "over"):
+			return age, defaultMaxAge, true
+		case strings.Contains(text, "under"):
+			return 0, age, true
+		}
+		return age, age, true
+	}
+	return 0, 0, false
+}
+
+// dateFit is 1 for an activity dated within the searched dates and 0 outside them
+func dateFit(activity Activity, req *SearchRequest) float64 {
+	if req.DateRange == nil || activity.Date == "" {
+		return unknownScore
+	}
+	if _, err := time.Parse("2006-01-02", activity.Date); err != nil {
+		return unknownScore
+	}
+	if activity.Date < req.DateRange.StartDate || activity.Date > req.DateRange.EndDate {
+		return 0
+	}
+	return 1
+}
+
+// defaultDistanceScaleKm is the distance that scores 0 when the search has no radius
+const defaultDistanceScaleKm = 50.0
+
+// distanceScore falls from 1 at the search location to 0 at the radius
+func distanceScore(activity Activity, req *SearchRequest) float64 {
+	if req.place == nil || activity.DistanceKm == nil {
+		return unknownScore
+	}
+	scale := defaultDistanceScaleKm
+	if req.RadiusKm > 0 {
+		scale = req.RadiusKm
+	}
+	return roundScore(math.Max(0, 1-*activity.DistanceKm/scale))
+}
+
+// priceAmount finds the first amount in a price such as "$15-$30", "From $20" or "$1,200"
+var priceAmount = regexp.MustCompile(`\d{1,3}(?:,\d{3})+(?:\.\d+)?|\d+(?:\.\d+)?`)
+
+// parsePrice returns the lowest price of an activity. A price that says "free"
+// without naming an amount is 0; "Free entry, rides $5" costs 5.
+func parsePrice(price string) (float64, bool) {
+	amount := priceAmount.FindString(price)
+	if amount == "" {
+		return 0, strings.Contains(strings.ToLower(price), "free")
+	}
+	value, err := strconv.ParseFloat(strings.ReplaceAll(amount, ",", ""), 64)
+	return value, err == nil
+}
+
+// priceScore favours cheaper activities: free scores 1, $30 scores 0.5
+func priceScore(activity Activity) float64 {
+	price, ok := parsePrice(activity.Price)
+	if !ok {
+		return unknownScore
+	}
+	return roundScore(1 / (1 + price/30))
+}
+
+// urlScore is 1 for a direct booking link, lower for a grounding redirect and 0 without one
+func urlScore(activity Activity) float64 {
+	u, err := url.Parse(strings.TrimSpace(activity.BookingURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return 0
+	}
+	if canonicalDomain(activity.BookingURL) == "" {
+		return 0.8 // Grounding redirect: valid, but the venue isn't known
+	}
+	return 1
+}
+
+// GroundingSupport links a segment of a Gemini answer to the grounding chunks backing it
+type GroundingSupport struct {
+	Segment               GroundingSegment `json:"segment"`
+	GroundingChunkIndices []int            `json:"groundingChunkIndices,omitempty"`
+	ConfidenceScores      []float64        `json:"confidenceScores,omitempty"`
+}
+
+// GroundingSegment is the part of a Gemini answer a grounding support refers to
+type GroundingSegment struct {
+	Text string `json:"text,omitempty"`
+}
+
+// groundingCollector gathers the grounding metadata of a search's Stage 1 answers
+type groundingCollector struct {
+	mu       sync.Mutex
+	chunks   []GroundingChunk
+	supports []GroundingSupport
+}
+
+// groundingCollectorKey is the context key for groundingCollector
+type groundingCollectorKey struct{}
+
+// withGroundingCollector returns a context that collects grounding metadata for ranking
+func withGroundingCollector(ctx context.Context) context.Context {
+	return context.WithValue(ctx, groundingCollectorKey{}, &groundingCollector{})
+}
+
+// recordGrounding adds the grounding metadata of a Gemini answer to the search in ctx
+func recordGrounding(ctx context.Context, metadata *GroundingMetadata) {
+	collector, ok := ctx.Value(groundingCollectorKey{}).(*groundingCollector)
+	if !ok || metadata == nil {
+		return
+	}
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	collector.chunks = append(collector.chunks, metadata.GroundingChunks...)
+	collector.supports = append(collector.supports, metadata.GroundingSupports...)
+}
+
+// groundingScore is the highest confidence Google Search grounding gave a
+// sentence naming the activity. An activity whose link came from a grounding
+// chunk but that no sentence names scores lower; an ungrounded one lower still.
+func groundingScore(ctx context.Context, activity Activity) float64 {
+	collector, ok := ctx.Value(groundingCollectorKey{}).(*groundingCollector)
+	if !ok {
+		return unknownScore
+	}
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	title := normalizeTitle(activity.Title)
+	best := -1.0
+	for _, support := range collector.supports {
+		if title == "" || !strings.Contains(normalizeTitle(support.Segment.Text), title) {
+			continue
+		}
+		for _, confidence := range support.ConfidenceScores {
+			best = math.Max(best, confidence)
+		}
+	}
+	if best >= 0 {
+		return roundScore(best)
+	}
+
+	for _, chunk := range collector.chunks {
+		if chunk.Web != nil && activity.BookingURL != "" && chunk.Web.URI == activity.BookingURL {
+			return 0.7
+		}
+	}
+	return 0.3
+}
+
+// roundScore keeps scores readable in responses
+func roundScore(score float64) float64 {
+	return math.Round(score*1000) / 1000
+}
@@ -0,0 +1,126 @@
+package schoolsout
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		price string
+		want  float64
+		ok    bool
+	}{
+		{"$15", 15, true},
+		{"$15-$30", 15, true},
+		{"From $20.50", 20.5, true},
+		{"$1,200", 1200, true},
+		{"$1,200.50 per term", 1200.5, true},
+		{"$5,10", 5, true},
+		{"Free", 0, true},
+		{"FREE entry", 0, true},
+		{"Free entry, rides $5", 5, true},
+		{"Free for members, $12 otherwise", 12, true},
+		{"", 0, false},
+		{"Contact venue", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.price, func(t *testing.T) {
+			got, ok := parsePrice(tt.price)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("parsePrice(%q) = %v, %v; want %v, %v", tt.price, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPriceScore(t *testing.T) {
+	tests := []struct {
+		price string
+		want  float64
+	}{
+		{"Free", 1},
+		{"$30", 0.5},
+		{"$1,200", roundScore(1 / (1 + 1200.0/30))},
+		{"Ask at the door", unknownScore},
+	}
+	for _, tt := range tests {
+		if got := priceScore(Activity{Price: tt.price}); got != tt.want {
+			t.Errorf("priceScore(%q) = %v, want %v", tt.price, got, tt.want)
+		}
+	}
+}
+
+func TestParseAgeRange(t *testing.T) {
+	tests := []struct {
+		text     string
+		min, max int
+		ok       bool
+	}{
+		{"6-12 years", 6, 12, true},
+		{"12-6", 6, 12, true},
+		{"5+", 5, defaultMaxAge, true},
+		{"Over 8", 8, defaultMaxAge, true},
+		{"Under 5", 0, 5, true},
+		{"All ages", 0, defaultMaxAge, true},
+		{"7", 7, 7, true},
+		{"Families", 0, 0, false},
+	}
+	for _, tt := range tests {
+		minAge, maxAge, ok := parseAgeRange(tt.text)
+		if minAge != tt.min || maxAge != tt.max || ok != tt.ok {
+			t.Errorf("parseAgeRange(%q) = %d, %d, %v; want %d, %d, %v", tt.text, minAge, maxAge, ok, tt.min, tt.max, tt.ok)
+		}
+	}
+}
+
+func TestAgeAndDateFit(t *testing.T) {
+	req := &SearchRequest{
+		AgeRange:  &AgeRange{Min: 5, Max: 9},
+		DateRange: &DateRange{StartDate: "2030-01-10", EndDate: "2030-01-20"},
+	}
+	if got := ageFit(Activity{AgeRange: "7-12"}, req); got != 0.6 {
+		t.Errorf("ageFit of a partial overlap = %v, want 0.6", got)
+	}
+	if got := ageFit(Activity{AgeRange: "13+"}, req); got != 0 {
+		t.Errorf("ageFit of no overlap = %v, want 0", got)
+	}
+	if got := ageFit(Activity{}, req); got != unknownScore {
+		t.Errorf("ageFit without an age range = %v, want unknown", got)
+	}
+	if got := dateFit(Activity{Date: "2030-01-15"}, req); got != 1 {
+		t.Errorf("dateFit inside the dates = %v, want 1", got)
+	}
+	if got := dateFit(Activity{Date: "2030-02-01"}, req); got != 0 {
+		t.Errorf("dateFit outside the dates = %v, want 0", got)
+	}
+	if got := dateFit(Activity{Date: "soon"}, req); got != unknownScore {
+		t.Errorf("dateFit of an unparsed date = %v, want unknown", got)
+	}
+}
+
+func TestRankActivitiesByPrice(t *testing.T) {
+	activities := []Activity{
+		{ID: "unknown", Price: "Contact venue"},
+		{ID: "big", Price: "$1,200"},
+		{ID: "free", Price: "Free"},
+		{ID: "rides", Price: "Free entry, rides $5"},
+	}
+	rankActivities(context.Background(), activities, &SearchRequest{Sort: sortPrice})
+
+	want := []string{"free", "rides", "big", "unknown"}
+	for i, activity := range activities {
+		if activity.ID != want[i] {
+			t.Fatalf("order = %v, want %v", activityIDs(activities), want)
+		}
+	}
+}
+
+// activityIDs lists the IDs of activities in order
+func activityIDs(activities []Activity) []string {
+	ids := make([]string, len(activities))
+	for i, activity := range activities {
+		ids[i] = activity.ID
+	}
+	return ids
+}
@@ -0,0 +1,129 @@
+package schoolsout
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// redactionRule replaces every match of pattern with replacement
+type redactionRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// redactionRules scrub secrets and personal information from log output.
+// Order matters: keys and emails are removed before the looser phone and address patterns run.
+var redactionRules = []redactionRule{
+	// Google API keys, wherever they appear
+	{regexp.MustCompile(`AIza[0-9A-Za-z_\-]{35}`), "[REDACTED_KEY]"},
+	// key=... query parameters
+	{regexp.MustCompile(`([?&](?:key|api_key|apiKey)=)[^&\s"']+`), "${1}[REDACTED_KEY]"},
+	// Email addresses
+	{regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`), "[REDACTED_EMAIL]"},
+	// Australian phone numbers: 0412 345 678, (08) 9123 4567, +61 8 9123 4567
+	{regexp.MustCompile(`(?:\+61[\s\-]?|\(0[2-478]\)\s?|\b0)[2-478]?(?:[\s\-]?\d){8}\b`), "[REDACTED_PHONE]"},
+	// Other international numbers: +44 20 7946 0958
+	{regexp.MustCompile(`\+\d{1,3}(?:[\s\-]?\(?\d{1,4}\)?){2,5}`), "[REDACTED_PHONE]"},
+	// Street addresses: 12 Smith Street, Unit 3/45 Hay St, 7A Ocean Pde
+	{regexp.MustCompile(`(?i)\b(?:(?:unit|apt|apartment|flat|suite)\s*\d+[a-z]?\s*[,/]?\s*)?\d+[a-z]?(?:[/\-]\d+[a-z]?)?\s+(?:[a-z'\-]+\s+){1,3}(?:street|st|road|rd|avenue|ave|drive|dr|court|ct|crescent|cres|place|pl|lane|ln|way|terrace|tce|parade|pde|boulevard|blvd|close|cl|highway|hwy)\b\.?`), "[REDACTED_ADDRESS]"},
+}
+
+var (
+	// knownSecrets holds exact secret values (e.g. the resolved API key) to scrub from logs
+	knownSecrets    = make(map[string]struct{})
+	knownSecretsMux sync.RWMutex
+)
+
+// registerSecret adds a value that must never appear in log output.
+// Registering the same value again has no effect.
+func registerSecret(secret string) {
+	if secret == "" {
+		return
+	}
+	knownSecretsMux.Lock()
+	defer knownSecretsMux.Unlock()
+	knownSecrets[secret] = struct{}{}
+}
+
+// redactString scrubs secrets and personal information from s
+func redactString(s string) string {
+	knownSecretsMux.RLock()
+	for secret := range knownSecrets {
+		s = strings.ReplaceAll(s, secret, "[REDACTED_KEY]")
+	}
+	knownSecretsMux.RUnlock()
+
+	for _, rule := range redactionRules {
+		s = rule.pattern.ReplaceAllString(s, rule.replacement)
+	}
+	return s
+}
+
+// redactingHandler scrubs the message and attribute values of every record
+type redactingHandler struct {
+	slog.Handler
+}
+
+// Handle implements slog.Handler
+func (h *redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, redactString(record.Message), record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, redacted)
+}
+
+// WithAttrs implements slog.Handler
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = redactAttr(a)
+	}
+	return &redactingHandler{Handler: h.Handler.WithAttrs(redacted)}
+}
+
+// WithGroup implements slog.Handler
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// redactAttr scrubs a single attribute, descending into groups and structured values
+func redactAttr(a slog.Attr) slog.Attr {
+	value := a.Value.Resolve()
+
+	switch value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(redactString(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			redacted[i] = redactAttr(ga)
+		}
+		a.Value = slog.GroupValue(redacted...)
+	case slog.KindAny:
+		switch v := value.Any().(type) {
+		case error:
+			a.Value = slog.StringValue(redactString(v.Error()))
+		default:
+			// Round-trip structured values through JSON so nested strings are scrubbed
+			data, err := json.Marshal(v)
+			if err != nil {
+				a.Value = slog.StringValue(redactString(value.String()))
+				break
+			}
+			scrubbed := []byte(redactString(string(data)))
+			if json.Valid(scrubbed) {
+				a.Value = slog.AnyValue(json.RawMessage(scrubbed))
+			} else {
+				a.Value = slog.StringValue(string(scrubbed))
+			}
+		}
+	}
+	return a
+}
@@ -0,0 +1,301 @@
+package schoolsout
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// middleware wraps a handler with cross-cutting behaviour
+type middleware func(http.HandlerFunc) http.HandlerFunc
+
+// route describes one path served by the function
+type route struct {
+	pattern string // http.ServeMux pattern
+	handler http.HandlerFunc
+	public  bool // skips API key authentication, e.g. for health probes and handlers with their own
+	userKey bool // needs a key from auth.userKeys, which identifies the user, instead of a client API key
+}
+
+// routes lists every path served by the SearchActivities entry point.
+// "/" and "/v1/search" both search, so existing clients keep working.
+var routes = []route{
+	{pattern: "/{$}", handler: handleSearch},
+	{pattern: "/v1/search", handler: handleSearch},
+	{pattern: "POST /v1/searches/{searchId}/refine", handler: handleRefineSearch},
+	{pattern: "POST /v1/itinerary", handler: handleItinerary},
+	{pattern: "GET /v1/activities/{id}", handler: handleGetActivity},
+	{pattern: "GET /v1/categories", handler: handleListCategories},
+	{pattern: "POST /v1/users/{userId}/saved-searches", handler: handleCreateSavedSearch, userKey: true},
+	{pattern: "GET /v1/users/{userId}/saved-searches", handler: handleListSavedSearches, userKey: true},
+	{pattern: "DELETE /v1/users/{userId}/saved-searches/{id}", handler: handleDeleteSavedSearch, userKey: true},
+	{pattern: "POST /v1/saved-searches/run", handler: RunSavedSearches, public: true}, // Authenticated with alerts.runKey
+	{pattern: "GET /debug/config", handler: EffectiveConfig},
+	{pattern: "GET /metrics", handler: Metrics},
+	{pattern: "GET /healthz", handler: handleHealthz, public: true},
+	{pattern: "GET /readyz", handler: handleReadyz, public: true},
+}
+
+// router dispatches requests to the routes
+var router = newRouter(routes)
+
+// newRouter builds a mux applying the same middleware chain to every route
+func newRouter(routes []route) http.Handler {
+	mux := http.NewServeMux()
+	for _, rt := range routes {
+		chain := []middleware{
+			withRequestLogging,
+			withRequestMetrics,
+			withRecovery,
+			withCORS,
+		}
+		// Public routes are probes and handlers that authenticate themselves, so
+		// they are neither authenticated nor rate limited per client IP
+		switch {
+		case rt.userKey:
+			chain = append(chain, withUserAuth, withRateLimit)
+		case !rt.public:
+			chain = append(chain, withAuth, withRateLimit)
+		}
+
+		mux.HandleFunc(rt.pattern, withTracing(rt.pattern, applyMiddleware(rt.handler, chain...)))
+	}
+
+	// Unknown paths still get a JSON body and CORS headers
+	mux.HandleFunc("/", withRequestLogging(withCORS(func(w http.ResponseWriter, r *http.Request) {
+		sendErrorResponse(w, http.StatusNotFound, "Not found")
+	})))
+
+	return mux
+}
+
+// applyMiddleware wraps h so that the first middleware is the outermost
+func applyMiddleware(h http.HandlerFunc, chain ...middleware) http.HandlerFunc {
+	for i := len(chain) - 1; i >= 0; i-- {
+		h = chain[i](h)
+	}
+	return h
+}
+
+// withRecovery turns a panic in a handler into a logged stack trace and a 500
+// SearchResponse with errorCode INTERNAL_ERROR, instead of a crashed instance
+func withRecovery(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			logger.ErrorContext(r.Context(), "Recovered from panic",
+				"panic", fmt.Sprint(recovered), slog.String("stack", string(debug.Stack())))
+
+			// Only write an error body if the handler had not started its response
+			if rec.status == 0 {
+				w.Header().Set("Content-Type", "application/json")
+				sendErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+			}
+		}()
+		next(rec, r)
+	}
+}
+
+// withCORS sets the JSON content type and CORS headers and answers preflight requests
+func withCORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		// Handle CORS preflight
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-None-Match, Authorization, X-API-Key")
+			w.Header().Set("Access-Control-Max-Age", "3600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		// Set CORS headers for actual requests
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Request-ID")
+
+		next(w, r)
+	}
+}
+
+// withAuth requires a client API key (X-API-Key or Authorization: Bearer) when
+// auth.apiKeys is configured. Without it the API stays public; configuring only
+// auth.userKeys locks the saved-search routes, not the search. A user key is
+// accepted too and identifies its user to the handler.
+func withAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := requestAPIKey(r)
+		if userID, ok := userForKey(key); ok {
+			next(w, r.WithContext(withAuthenticatedUser(r.Context(), userID)))
+			return
+		}
+		if len(appConfig.Auth.APIKeys) == 0 || isClientAPIKey(key) {
+			next(w, r)
+			return
+		}
+		sendUnauthorized(w, r, "Missing or invalid API key")
+	}
+}
+
+// withUserAuth requires a user key from auth.userKeys and records its user for
+// the handler, which checks it owns the resource. A shared client API key gets
+// through to be refused by the handler with 403.
+func withUserAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := requestAPIKey(r)
+		if userID, ok := userForKey(key); ok {
+			next(w, r.WithContext(withAuthenticatedUser(r.Context(), userID)))
+			return
+		}
+		if isClientAPIKey(key) {
+			next(w, r)
+			return
+		}
+		sendUnauthorized(w, r, "Missing or invalid user key")
+	}
+}
+
+// isClientAPIKey reports whether key is one of auth.apiKeys
+func isClientAPIKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, allowed := range appConfig.Auth.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(allowed)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// sendUnauthorized rejects a request without an acceptable key
+func sendUnauthorized(w http.ResponseWriter, r *http.Request, message string) {
+	logger.WarnContext(r.Context(), "Unauthorized request", "path", r.URL.Path)
+	w.Header().Set("WWW-Authenticate", `Bearer realm="schoolsout"`)
+	sendErrorResponse(w, http.StatusUnauthorized, message)
+}
+
+// requestAPIKey returns the key sent in X-API-Key or as an Authorization bearer token
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// userForKey returns the user a key from auth.userKeys acts for
+func userForKey(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	for userID, allowed := range appConfig.Auth.UserKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(allowed)) == 1 {
+			return userID, true
+		}
+	}
+	return "", false
+}
+
+// authenticatedUserKey is the context key for the user a request's key acts for
+type authenticatedUserKey struct{}
+
+// withAuthenticatedUser returns a context recording the user a request acts for
+func withAuthenticatedUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, authenticatedUserKey{}, userID)
+}
+
+// authenticatedUser returns the user the request's key acts for, if it is a user key
+func authenticatedUser(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(authenticatedUserKey{}).(string)
+	return userID, ok
+}
+
+// withRateLimit rejects clients that exceed the per-IP rate limit
+func withRateLimit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if !checkRateLimit(ctx, getClientIP(r)) {
+			metrics.recordRateLimited(ctx)
+			sendErrorResponse(w, http.StatusTooManyRequests, "Rate limit exceeded. Please try again later.")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// ActivityResponse represents the response model for a single activity
+type ActivityResponse struct {
+	Success  bool      `json:"success"`
+	Activity *Activity `json:"activity,omitempty"`
+}
+
+// handleGetActivity returns an activity from an earlier search by its ID, as JSON
+// or, with format=ics, as an iCalendar event
+func handleGetActivity(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	format, err := responseFormat(r, formatJSON, formatICS)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	activity, err := activityStore.Get(ctx, r.PathValue("id"))
+	metrics.recordCacheLookup(ctx, "activities", err == nil)
+	if errors.Is(err, ErrActivityNotFound) {
+		sendErrorResponse(w, http.StatusNotFound, "Activity not found")
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to look up activity", "id", r.PathValue("id"), "error", err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to look up activity")
+		return
+	}
+
+	maxAge := time.Duration(appConfig.Search.CacheMaxAge)
+	if format == formatICS {
+		day, err := time.Parse("2006-01-02", activity.Date)
+		if err != nil {
+			sendErrorResponse(w, http.StatusUnprocessableEntity, "Activity has no date to add to a calendar")
+			return
+		}
+		writeCalendarResponse(w, r, activity.Title, "activity.ics", []calendarEvent{activityEvent(ctx, activity, day)}, maxAge)
+		return
+	}
+
+	writeCacheableJSON(w, r, ActivityResponse{Success: true, Activity: &activity}, maxAge)
+}
+
+// CategoriesResponse represents the response model for the category list
+type CategoriesResponse struct {
+	Success    bool     `json:"success"`
+	Categories []string `json:"categories"`
+}
+
+// handleListCategories lists the activity categories Stage 2 maps results into
+func handleListCategories(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(CategoriesResponse{
+		Success:    true,
+		Categories: activityCategories,
+	})
+}
@@ -0,0 +1,548 @@
+package schoolsout
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits on saved searches
+const (
+	maxSavedSearchesPerUser = 20
+	maxSeenActivityIDs      = 500 // Most recent IDs kept per saved search for diffing
+	maxUserIDLength         = 128
+)
+
+var (
+	// ErrSavedSearchNotFound is returned when a user has no saved search with an ID
+	ErrSavedSearchNotFound = errors.New("saved search not found")
+
+	// ErrTooManySavedSearches is returned when a user already has maxSavedSearchesPerUser saved searches
+	ErrTooManySavedSearches = fmt.Errorf("a user can have at most %d saved searches", maxSavedSearchesPerUser)
+)
+
+// SavedSearch is a search a user wants re-run, with the activities it has already found
+type SavedSearch struct {
+	ID              string        `json:"id"`
+	UserID          string        `json:"userId"`
+	Name            string        `json:"name"`
+	Search          SearchRequest `json:"search"`
+	SeenActivityIDs []string      `json:"seenActivityIds,omitempty"`
+	CreatedAt       time.Time     `json:"createdAt"`
+	LastRunAt       time.Time     `json:"lastRunAt"`
+}
+
+// SavedSearchRequest represents the request model for saving a search
+type SavedSearchRequest struct {
+	Name   string        `json:"name"`
+	Search SearchRequest `json:"search"`
+}
+
+// SavedSearchResponse represents the response model for a single saved search
+type SavedSearchResponse struct {
+	Success     bool         `json:"success"`
+	SavedSearch *SavedSearch `json:"savedSearch,omitempty"`
+}
+
+// SavedSearchesResponse represents the response model for a user's saved searches
+type SavedSearchesResponse struct {
+	Success       bool          `json:"success"`
+	SavedSearches []SavedSearch `json:"savedSearches"`
+}
+
+// SavedSearchRunResponse summarises one run of RunSavedSearches
+type SavedSearchRunResponse struct {
+	Success  bool `json:"success"`
+	Searched int  `json:"searched"`
+	Notified int  `json:"notified"` // Saved searches that found new activities
+	Failed   int  `json:"failed"`
+	Skipped  int  `json:"skipped"` // Left for the next run by alerts.maxSearchesPerRun or the token budget
+}
+
+// SavedSearchStore keeps users' saved searches
+type SavedSearchStore interface {
+	// Create adds a saved search, or returns ErrTooManySavedSearches when its user
+	// already has maxSavedSearchesPerUser
+	Create(ctx context.Context, search SavedSearch) error
+	// Update replaces a saved search, or returns ErrSavedSearchNotFound when it
+	// has been deleted, so a run can't bring it back
+	Update(ctx context.Context, search SavedSearch) error
+	// List returns a user's saved searches, or every saved search when userID is empty, oldest first
+	List(ctx context.Context, userID string) ([]SavedSearch, error)
+	// Delete removes a user's saved search, or returns ErrSavedSearchNotFound
+	Delete(ctx context.Context, userID, id string) error
+}
+
+var (
+	// savedSearchStore holds the saved searches run by RunSavedSearches
+	savedSearchStore SavedSearchStore
+
+	// savedSearchStoreErr is why the configured store couldn't be opened, reported by /readyz
+	savedSearchStoreErr error
+)
+
+func init() {
+	savedSearchStore, savedSearchStoreErr = newSavedSearchStore(appConfig.Alerts)
+	if savedSearchStoreErr != nil {
+		logger.Error("Failed to open saved search store, keeping saved searches in memory", "backend", appConfig.Alerts.Backend, "error", savedSearchStoreErr)
+		savedSearchStore = NewMemorySavedSearchStore()
+	}
+	registerReadinessCheck(healthCheckFunc{name: "savedSearches", check: checkSavedSearchStore})
+}
+
+// newSavedSearchStore opens the saved search store for the configured backend
+func newSavedSearchStore(cfg AlertsConfig) (SavedSearchStore, error) {
+	switch cfg.Backend {
+	case storeBackendFile:
+		return NewFileSavedSearchStore(cfg.Path)
+	default:
+		return NewMemorySavedSearchStore(), nil
+	}
+}
+
+// checkSavedSearchStore verifies that the configured saved search store is in use
+func checkSavedSearchStore(ctx context.Context) error {
+	if savedSearchStoreErr != nil {
+		return fmt.Errorf("saved search store unavailable: %w", savedSearchStoreErr)
+	}
+	return nil
+}
+
+// authorizedUserID returns the {userId} of a saved search request once it has
+// checked that the request's key is the user key of that user. Saved searches
+// are private to their user, so shared API keys can't reach them.
+func authorizedUserID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID := r.PathValue("userId")
+	if err := validUserID(userID); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+	if authenticated, ok := authenticatedUser(r.Context()); !ok || authenticated != userID {
+		logger.WarnContext(r.Context(), "Saved search access denied", "userId", userID)
+		sendErrorResponse(w, http.StatusForbidden, "Saved searches need the API key of the user they belong to")
+		return "", false
+	}
+	return userID, true
+}
+
+// handleCreateSavedSearch saves a search for a user (POST /v1/users/{userId}/saved-searches)
+func handleCreateSavedSearch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := authorizedUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var body SavedSearchRequest
+	if status, err := decodeJSONBody(w, r, &body); err != nil {
+		logger.WarnContext(ctx, "Invalid request body", "error", err)
+		sendErrorResponse(w, status, err.Error())
+		return
+	}
+
+	// Pagination and debugging don't apply to scheduled runs
+	search := body.Search
+	search.PageSize, search.PageToken, search.Debug = 0, "", false
+	if err := search.validate(); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := search.resolvePlace(ctx); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Checked now, as every run of a dateless search resolves the holidays again
+	if err := search.checkHolidayCalendar(); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		name = search.Query
+	}
+	saved := SavedSearch{
+		ID:        newRequestID(),
+		UserID:    userID,
+		Name:      name,
+		Search:    search,
+		CreatedAt: time.Now().UTC(),
+	}
+	err := savedSearchStore.Create(ctx, saved)
+	if errors.Is(err, ErrTooManySavedSearches) {
+		sendErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("A user can have at most %d saved searches", maxSavedSearchesPerUser))
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to save search", "error", err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to save search")
+		return
+	}
+
+	logger.InfoContext(ctx, "Saved search", "userId", userID, "savedSearchId", saved.ID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(SavedSearchResponse{Success: true, SavedSearch: &saved})
+}
+
+// handleListSavedSearches lists a user's saved searches (GET /v1/users/{userId}/saved-searches)
+func handleListSavedSearches(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := authorizedUserID(w, r)
+	if !ok {
+		return
+	}
+
+	searches, err := savedSearchStore.List(ctx, userID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to list saved searches", "error", err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to list saved searches")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(SavedSearchesResponse{Success: true, SavedSearches: searches})
+}
+
+// handleDeleteSavedSearch removes a saved search (DELETE /v1/users/{userId}/saved-searches/{id})
+func handleDeleteSavedSearch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := authorizedUserID(w, r)
+	if !ok {
+		return
+	}
+	err := savedSearchStore.Delete(ctx, userID, r.PathValue("id"))
+	if errors.Is(err, ErrSavedSearchNotFound) {
+		sendErrorResponse(w, http.StatusNotFound, "Saved search not found")
+		return
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to delete saved search", "error", err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to delete saved search")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(SavedSearchResponse{Success: true})
+}
+
+// RunSavedSearches is the scheduled entry point (e.g. Cloud Scheduler → POST) that
+// re-runs every saved search and notifies users of activities they haven't seen.
+// The scheduler authenticates with alerts.runKey.
+func RunSavedSearches(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed. Use POST.")
+		return
+	}
+	if !authorizeRun(w, r) {
+		return
+	}
+
+	ctx := r.Context()
+	searches, err := savedSearchStore.List(ctx, "")
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to list saved searches", "error", err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Failed to list saved searches")
+		return
+	}
+
+	// Run the searches that waited longest first, so a run cut short by
+	// alerts.maxSearchesPerRun doesn't starve the rest
+	sort.SliceStable(searches, func(i, j int) bool {
+		return searches[i].LastRunAt.Before(searches[j].LastRunAt)
+	})
+
+	response := SavedSearchRunResponse{Success: true}
+	for i, saved := range searches {
+		if i >= appConfig.Alerts.MaxSearchesPerRun {
+			response.Skipped = len(searches) - i
+			break
+		}
+		if err := dailyBudgetError(); err != nil {
+			logger.WarnContext(ctx, "Stopping saved search run", "error", err)
+			response.Skipped = len(searches) - i
+			break
+		}
+
+		found, err := runSavedSearch(ctx, saved)
+		response.Searched++
+		if err != nil {
+			logger.ErrorContext(ctx, "Saved search run failed", "savedSearchId", saved.ID, "error", err)
+			response.Failed++
+			continue
+		}
+		if found > 0 {
+			response.Notified++
+		}
+	}
+
+	logger.InfoContext(ctx, "Saved search run completed",
+		"searched", response.Searched,
+		"notified", response.Notified,
+		"failed", response.Failed,
+		"skipped", response.Skipped)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// authorizeRun checks that a saved search run was sent with alerts.runKey. A run
+// spends tokens on every user's searches, so runs are refused while no run key
+// is configured, whatever auth.apiKeys holds.
+func authorizeRun(w http.ResponseWriter, r *http.Request) bool {
+	runKey := appConfig.Alerts.RunKey
+	if runKey == "" {
+		logger.WarnContext(r.Context(), "Saved search run refused: alerts.runKey is not configured")
+		sendErrorResponse(w, http.StatusForbidden, "Saved search runs are disabled")
+		return false
+	}
+	key := requestAPIKey(r)
+	if key == "" || subtle.ConstantTimeCompare([]byte(key), []byte(runKey)) != 1 {
+		logger.WarnContext(r.Context(), "Unauthorized saved search run")
+		w.Header().Set("WWW-Authenticate", `Bearer realm="schoolsout"`)
+		sendErrorResponse(w, http.StatusUnauthorized, "Missing or invalid run key")
+		return false
+	}
+	return true
+}
+
+// runSavedSearch re-runs one saved search and notifies its user of new activities.
+// The first run only records a baseline. It returns the number of new activities.
+func runSavedSearch(ctx context.Context, saved SavedSearch) (int, error) {
+	ctx = withUsageTracker(ctx)
+	search := saved.Search
+	if err := search.resolvePlace(ctx); err != nil {
+		return 0, err
+	}
+	if _, err := search.resolveHolidayWindow(time.Now()); err != nil {
+		return 0, err
+	}
+	activities, err := performSearch(ctx, &search)
+	if err != nil {
+		return 0, err
+	}
+	activities = search.Filters.apply(activities)
+
+	seen := make(map[string]bool, len(saved.SeenActivityIDs))
+	for _, id := range saved.SeenActivityIDs {
+		seen[id] = true
+	}
+	var fresh []Activity
+	for _, activity := range activities {
+		if !seen[activity.ID] {
+			seen[activity.ID] = true
+			fresh = append(fresh, activity)
+			saved.SeenActivityIDs = append(saved.SeenActivityIDs, activity.ID)
+		}
+	}
+	if len(saved.SeenActivityIDs) > maxSeenActivityIDs {
+		saved.SeenActivityIDs = saved.SeenActivityIDs[len(saved.SeenActivityIDs)-maxSeenActivityIDs:]
+	}
+
+	firstRun := saved.LastRunAt.IsZero()
+	saved.LastRunAt = time.Now().UTC()
+
+	// Notify before saving, so a failed notification is retried on the next run
+	if len(fresh) > 0 && !firstRun {
+		event := NewActivitiesEvent{
+			UserID:        saved.UserID,
+			SavedSearchID: saved.ID,
+			Name:          saved.Name,
+			Search:        saved.Search,
+			Activities:    fresh,
+			FoundAt:       saved.LastRunAt,
+		}
+		if err := notifier.Notify(ctx, event); err != nil {
+			return 0, fmt.Errorf("failed to notify: %w", err)
+		}
+	}
+
+	err = savedSearchStore.Update(ctx, saved)
+	if errors.Is(err, ErrSavedSearchNotFound) {
+		logger.InfoContext(ctx, "Saved search deleted during its run", "savedSearchId", saved.ID)
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to update saved search: %w", err)
+	}
+
+	if firstRun {
+		return 0, nil
+	}
+	return len(fresh), nil
+}
+
+// validUserID checks the userId path parameter
+func validUserID(userID string) error {
+	if strings.TrimSpace(userID) == "" || len(userID) > maxUserIDLength {
+		return fmt.Errorf("userId must be between 1 and %d characters", maxUserIDLength)
+	}
+	return nil
+}
+
+// MemorySavedSearchStore keeps saved searches in this instance's memory
+type MemorySavedSearchStore struct {
+	mu       sync.RWMutex
+	searches map[string]SavedSearch
+}
+
+// NewMemorySavedSearchStore creates an empty in-memory saved search store
+func NewMemorySavedSearchStore() *MemorySavedSearchStore {
+	return &MemorySavedSearchStore{searches: make(map[string]SavedSearch)}
+}
+
+// Create implements SavedSearchStore
+func (s *MemorySavedSearchStore) Create(ctx context.Context, search SavedSearch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.create(search)
+}
+
+// create adds a saved search within its user's limit. Caller must hold s.mu.
+func (s *MemorySavedSearchStore) create(search SavedSearch) error {
+	if len(s.list(search.UserID)) >= maxSavedSearchesPerUser {
+		return ErrTooManySavedSearches
+	}
+	s.searches[search.ID] = search
+	return nil
+}
+
+// Update implements SavedSearchStore
+func (s *MemorySavedSearchStore) Update(ctx context.Context, search SavedSearch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.update(search)
+}
+
+// update replaces a saved search that still exists. Caller must hold s.mu.
+func (s *MemorySavedSearchStore) update(search SavedSearch) error {
+	existing, ok := s.searches[search.ID]
+	if !ok || existing.UserID != search.UserID {
+		return ErrSavedSearchNotFound
+	}
+	s.searches[search.ID] = search
+	return nil
+}
+
+// List implements SavedSearchStore
+func (s *MemorySavedSearchStore) List(ctx context.Context, userID string) ([]SavedSearch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.list(userID), nil
+}
+
+// list returns matching saved searches, oldest first. Caller must hold s.mu.
+func (s *MemorySavedSearchStore) list(userID string) []SavedSearch {
+	searches := make([]SavedSearch, 0)
+	for _, search := range s.searches {
+		if userID == "" || search.UserID == userID {
+			searches = append(searches, search)
+		}
+	}
+	sort.Slice(searches, func(i, j int) bool {
+		return searches[i].CreatedAt.Before(searches[j].CreatedAt)
+	})
+	return searches
+}
+
+// Delete implements SavedSearchStore
+func (s *MemorySavedSearchStore) Delete(ctx context.Context, userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.delete(userID, id)
+}
+
+// delete removes a saved search. Caller must hold s.mu.
+func (s *MemorySavedSearchStore) delete(userID, id string) error {
+	search, ok := s.searches[id]
+	if !ok || search.UserID != userID {
+		return ErrSavedSearchNotFound
+	}
+	delete(s.searches, id)
+	return nil
+}
+
+// FileSavedSearchStore keeps saved searches in memory and writes them to a JSON
+// file after every change
+type FileSavedSearchStore struct {
+	*MemorySavedSearchStore
+	path string
+}
+
+// NewFileSavedSearchStore opens the store at path, loading any saved searches already there
+func NewFileSavedSearchStore(path string) (*FileSavedSearchStore, error) {
+	s := &FileSavedSearchStore{
+		MemorySavedSearchStore: NewMemorySavedSearchStore(),
+		path:                   path,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read saved search store: %w", err)
+	}
+
+	var searches []SavedSearch
+	if err := json.Unmarshal(data, &searches); err != nil {
+		return nil, fmt.Errorf("failed to parse saved search store %s: %w", path, err)
+	}
+	for _, search := range searches {
+		s.searches[search.ID] = search
+	}
+	return s, nil
+}
+
+// Create implements SavedSearchStore
+func (s *FileSavedSearchStore) Create(ctx context.Context, search SavedSearch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.create(search); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// Update implements SavedSearchStore
+func (s *FileSavedSearchStore) Update(ctx context.Context, search SavedSearch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.update(search); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// Delete implements SavedSearchStore
+func (s *FileSavedSearchStore) Delete(ctx context.Context, userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.delete(userID, id); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// save writes the store to its file. Caller must hold s.mu.
+func (s *FileSavedSearchStore) save() error {
+	data, err := json.Marshal(s.list(""))
+	if err != nil {
+		return fmt.Errorf("failed to encode saved search store: %w", err)
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to write saved search store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package schoolsout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestSavedSearchesNeedTheUsersKey(t *testing.T) {
+	userKeys := appConfig.Auth.UserKeys
+	appConfig.Auth.UserKeys = map[string]string{"alice": "alice-key", "bob": "bob-key"}
+	t.Cleanup(func() { appConfig.Auth.UserKeys = userKeys })
+
+	tests := []struct {
+		name   string
+		path   string
+		key    string
+		status int
+	}{
+		{"no key", "/v1/users/alice/saved-searches", "", http.StatusUnauthorized},
+		{"unknown key", "/v1/users/alice/saved-searches", "guess", http.StatusUnauthorized},
+		{"another user's key", "/v1/users/alice/saved-searches", "bob-key", http.StatusForbidden},
+		{"own key", "/v1/users/alice/saved-searches", "alice-key", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+func TestRunSavedSearchesNeedsRunKey(t *testing.T) {
+	runKey := appConfig.Alerts.RunKey
+	t.Cleanup(func() { appConfig.Alerts.RunKey = runKey })
+
+	tests := []struct {
+		name   string
+		runKey string
+		key    string
+		status int
+	}{
+		{"not configured", "", "", http.StatusForbidden},
+		{"not configured, any key", "", "anything", http.StatusForbidden},
+		{"missing key", "run-key", "", http.StatusUnauthorized},
+		{"wrong key", "run-key", "guess", http.StatusUnauthorized},
+		{"run key", "run-key", "run-key", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appConfig.Alerts.RunKey = tt.runKey
+			req := httptest.NewRequest(http.MethodPost, "/v1/saved-searches/run", nil)
+			if tt.key != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.key)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+// recordingNotifier keeps the events it is asked to deliver
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []NewActivitiesEvent
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, event NewActivitiesEvent) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, event)
+	return nil
+}
+
+// useSavedSearchStore swaps in an empty memory store and a recording notifier
+func useSavedSearchStore(t *testing.T) (*MemorySavedSearchStore, *recordingNotifier) {
+	t.Helper()
+	store, events := NewMemorySavedSearchStore(), &recordingNotifier{}
+	previousStore, previousNotifier := savedSearchStore, notifier
+	savedSearchStore, notifier = store, events
+	t.Cleanup(func() { savedSearchStore, notifier = previousStore, previousNotifier })
+	return store, events
+}
+
+func TestSavedSearchStoreLimitsEachUser(t *testing.T) {
+	store := NewMemorySavedSearchStore()
+	ctx := context.Background()
+	for i := range maxSavedSearchesPerUser {
+		if err := store.Create(ctx, SavedSearch{ID: fmt.Sprintf("alice-%d", i), UserID: "alice"}); err != nil {
+			t.Fatalf("Create %d: %v", i, err)
+		}
+	}
+	if err := store.Create(ctx, SavedSearch{ID: "alice-extra", UserID: "alice"}); !errors.Is(err, ErrTooManySavedSearches) {
+		t.Errorf("Create over the limit = %v, want ErrTooManySavedSearches", err)
+	}
+	if err := store.Create(ctx, SavedSearch{ID: "bob-0", UserID: "bob"}); err != nil {
+		t.Errorf("another user's Create = %v", err)
+	}
+}
+
+func TestSavedSearchStoreCreateIsAtomic(t *testing.T) {
+	store := NewMemorySavedSearchStore()
+	var wg sync.WaitGroup
+	for i := range 2 * maxSavedSearchesPerUser {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.Create(context.Background(), SavedSearch{ID: fmt.Sprintf("s-%d", i), UserID: "alice"})
+		}()
+	}
+	wg.Wait()
+	searches, _ := store.List(context.Background(), "alice")
+	if len(searches) != maxSavedSearchesPerUser {
+		t.Errorf("user has %d saved searches, want %d", len(searches), maxSavedSearchesPerUser)
+	}
+}
+
+func TestSavedSearchStoreUpdate(t *testing.T) {
+	dir := t.TempDir()
+	fileStore, err := NewFileSavedSearchStore(filepath.Join(dir, "saved.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]SavedSearchStore{"memory": NewMemorySavedSearchStore(), "file": fileStore}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			saved := SavedSearch{ID: "s1", UserID: "alice", Name: "before"}
+			if err := store.Update(ctx, saved); !errors.Is(err, ErrSavedSearchNotFound) {
+				t.Errorf("Update before Create = %v, want ErrSavedSearchNotFound", err)
+			}
+			if err := store.Create(ctx, saved); err != nil {
+				t.Fatal(err)
+			}
+			saved.Name = "after"
+			if err := store.Update(ctx, saved); err != nil {
+				t.Errorf("Update = %v", err)
+			}
+			if err := store.Update(ctx, SavedSearch{ID: "s1", UserID: "bob"}); !errors.Is(err, ErrSavedSearchNotFound) {
+				t.Errorf("Update by another user = %v, want ErrSavedSearchNotFound", err)
+			}
+			if err := store.Delete(ctx, "alice", "s1"); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Update(ctx, saved); !errors.Is(err, ErrSavedSearchNotFound) {
+				t.Errorf("Update after Delete = %v, want ErrSavedSearchNotFound", err)
+			}
+			if searches, _ := store.List(ctx, "alice"); len(searches) != 0 {
+				t.Errorf("Update recreated the deleted search: %+v", searches)
+			}
+		})
+	}
+}
+
+func TestRunSavedSearchNotifiesNewActivities(t *testing.T) {
+	store, events := useSavedSearchStore(t)
+	gemini := useFakeGemini(t,
+		Activity{Title: "Zoo day", Category: "outdoor", BookingURL: "https://zoo.example.com/day"},
+		Activity{Title: "Museum tour", Category: "educational", BookingURL: "https://museum.example.com/tour"},
+	)
+	ctx := context.Background()
+	saved := SavedSearch{
+		ID:     "s1",
+		UserID: "alice",
+		Name:   "Holidays",
+		Search: SearchRequest{Query: "things to do", DateRange: &DateRange{StartDate: "2030-01-01", EndDate: "2030-01-31"}},
+	}
+	if err := store.Create(ctx, saved); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first run records what was already there without notifying
+	if n, err := runSavedSearch(ctx, saved); err != nil || n != 0 {
+		t.Fatalf("first run = %d, %v; want 0, nil", n, err)
+	}
+	if len(events.events) != 0 {
+		t.Fatalf("first run notified: %+v", events.events)
+	}
+	searches, _ := store.List(ctx, "alice")
+	if len(searches) != 1 || len(searches[0].SeenActivityIDs) != 2 || searches[0].LastRunAt.IsZero() {
+		t.Fatalf("after first run = %+v", searches)
+	}
+
+	// A later run notifies only the activities it hasn't seen
+	gemini.setActivities(
+		Activity{Title: "Zoo day", Category: "outdoor", BookingURL: "https://zoo.example.com/day"},
+		Activity{Title: "Pottery class", Category: "creative", BookingURL: "https://pottery.example.com/class"},
+	)
+	n, err := runSavedSearch(ctx, searches[0])
+	if err != nil || n != 1 {
+		t.Fatalf("second run = %d, %v; want 1, nil", n, err)
+	}
+	if len(events.events) != 1 {
+		t.Fatalf("notified %d times, want 1", len(events.events))
+	}
+	event := events.events[0]
+	if event.UserID != "alice" || event.SavedSearchID != "s1" || len(event.Activities) != 1 || event.Activities[0].Title != "Pottery class" {
+		t.Errorf("event = %+v", event)
+	}
+	searches, _ = store.List(ctx, "alice")
+	if len(searches[0].SeenActivityIDs) != 3 {
+		t.Errorf("seen %d activities, want 3", len(searches[0].SeenActivityIDs))
+	}
+
+	// Nothing new, nothing to notify
+	if n, err := runSavedSearch(ctx, searches[0]); err != nil || n != 0 {
+		t.Errorf("third run = %d, %v; want 0, nil", n, err)
+	}
+	if len(events.events) != 1 {
+		t.Errorf("notified %d times, want 1", len(events.events))
+	}
+}
+
+func TestRunSavedSearchDoesNotRecreateDeletedSearch(t *testing.T) {
+	store, _ := useSavedSearchStore(t)
+	useFakeGemini(t, Activity{Title: "Zoo day", Category: "outdoor", BookingURL: "https://zoo.example.com/day"})
+	ctx := context.Background()
+	saved := SavedSearch{ID: "s1", UserID: "alice", Search: SearchRequest{Query: "things to do"}}
+	if err := store.Create(ctx, saved); err != nil {
+		t.Fatal(err)
+	}
+	// Deleted after the run has read it
+	if err := store.Delete(ctx, "alice", "s1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := runSavedSearch(ctx, saved); err != nil || n != 0 {
+		t.Errorf("run = %d, %v; want 0, nil", n, err)
+	}
+	if searches, _ := store.List(ctx, "alice"); len(searches) != 0 {
+		t.Errorf("run recreated the deleted search: %+v", searches)
+	}
+}
+
+func TestUserKeysOnlyLockSavedSearches(t *testing.T) {
+	apiKeys, userKeys := appConfig.Auth.APIKeys, appConfig.Auth.UserKeys
+	t.Cleanup(func() { appConfig.Auth.APIKeys, appConfig.Auth.UserKeys = apiKeys, userKeys })
+
+	tests := []struct {
+		name    string
+		apiKeys []string
+		path    string
+		key     string
+		status  int
+	}{
+		{"user keys only, public route", nil, "/v1/categories", "", http.StatusOK},
+		{"user keys only, saved searches", nil, "/v1/users/alice/saved-searches", "", http.StatusUnauthorized},
+		{"api keys, public route without key", []string{"client-key"}, "/v1/categories", "", http.StatusUnauthorized},
+		{"api keys, public route with key", []string{"client-key"}, "/v1/categories", "client-key", http.StatusOK},
+		{"api keys, public route with user key", []string{"client-key"}, "/v1/categories", "alice-key", http.StatusOK},
+		{"api keys, saved searches with client key", []string{"client-key"}, "/v1/users/alice/saved-searches", "client-key", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appConfig.Auth.APIKeys = tt.apiKeys
+			appConfig.Auth.UserKeys = map[string]string{"alice": "alice-key"}
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set("X-API-Key", tt.key)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
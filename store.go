@@ -0,0 +1,228 @@
+package schoolsout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Activity store backends
+const (
+	storeBackendMemory = "memory"
+	storeBackendFile   = "file"
+)
+
+// ErrActivityNotFound is returned when no activity is stored under an ID
+var ErrActivityNotFound = errors.New("activity not found")
+
+// ActivityStore keeps the activities returned by searches so they can be looked up by ID
+type ActivityStore interface {
+	// Put stores activities, replacing any already stored under the same ID
+	Put(ctx context.Context, activities []Activity) error
+	// Get returns the activity stored under id, or ErrActivityNotFound
+	Get(ctx context.Context, id string) (Activity, error)
+}
+
+var (
+	// activityStore holds every activity returned by a search
+	activityStore ActivityStore
+
+	// activityStoreErr is why the configured store couldn't be opened, reported by /readyz
+	activityStoreErr error
+)
+
+func init() {
+	activityStore, activityStoreErr = newActivityStore(appConfig.Store)
+	if activityStoreErr != nil {
+		logger.Error("Failed to open activity store, keeping activities in memory", "backend", appConfig.Store.Backend, "error", activityStoreErr)
+		activityStore = NewMemoryActivityStore(appConfig.Store.MaxActivities)
+	}
+	registerReadinessCheck(healthCheckFunc{name: "store", check: checkActivityStore})
+}
+
+// newActivityStore opens the store for the configured backend
+func newActivityStore(cfg StoreConfig) (ActivityStore, error) {
+	switch cfg.Backend {
+	case storeBackendFile:
+		return NewFileActivityStore(cfg.Path, cfg.MaxActivities)
+	default:
+		return NewMemoryActivityStore(cfg.MaxActivities), nil
+	}
+}
+
+// validStoreBackend reports whether name is a supported store backend
+func validStoreBackend(name string) error {
+	switch name {
+	case storeBackendMemory, storeBackendFile:
+		return nil
+	}
+	return fmt.Errorf("store.backend must be memory or file")
+}
+
+// checkActivityStore verifies that the configured activity store is in use
+func checkActivityStore(ctx context.Context) error {
+	if activityStoreErr != nil {
+		return fmt.Errorf("activity store unavailable: %w", activityStoreErr)
+	}
+	return nil
+}
+
+// MemoryActivityStore keeps activities in this instance's memory. Once it holds
+// maxActivities, the oldest activities are evicted first.
+type MemoryActivityStore struct {
+	mu            sync.RWMutex
+	activities    map[string]Activity
+	order         []string // IDs in insertion order, for eviction
+	maxActivities int
+}
+
+// NewMemoryActivityStore creates an empty in-memory store; maxActivities <= 0 means unbounded
+func NewMemoryActivityStore(maxActivities int) *MemoryActivityStore {
+	return &MemoryActivityStore{
+		activities:    make(map[string]Activity),
+		maxActivities: maxActivities,
+	}
+}
+
+// Put implements ActivityStore
+func (s *MemoryActivityStore) Put(ctx context.Context, activities []Activity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(activities)
+	return nil
+}
+
+// put stores activities and evicts the oldest beyond maxActivities. Caller must hold s.mu.
+func (s *MemoryActivityStore) put(activities []Activity) {
+	for _, activity := range activities {
+		if activity.ID == "" {
+			continue
+		}
+		if _, ok := s.activities[activity.ID]; !ok {
+			s.order = append(s.order, activity.ID)
+		}
+		s.activities[activity.ID] = activity
+	}
+
+	if s.maxActivities > 0 && len(s.order) > s.maxActivities {
+		evict := s.order[:len(s.order)-s.maxActivities]
+		for _, id := range evict {
+			delete(s.activities, id)
+		}
+		s.order = append([]string(nil), s.order[len(evict):]...)
+	}
+}
+
+// Get implements ActivityStore
+func (s *MemoryActivityStore) Get(ctx context.Context, id string) (Activity, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	activity, ok := s.activities[id]
+	if !ok {
+		return Activity{}, ErrActivityNotFound
+	}
+	return activity, nil
+}
+
+// snapshot returns the stored activities, oldest first. Caller must hold s.mu.
+func (s *MemoryActivityStore) snapshot() []Activity {
+	activities := make([]Activity, 0, len(s.order))
+	for _, id := range s.order {
+		activities = append(activities, s.activities[id])
+	}
+	return activities
+}
+
+// FileActivityStore keeps activities in memory and writes them to a JSON file
+// after every change, so they survive restarts when the path is on a mounted volume.
+//
+// It is meant for local runs and single instances: every Put rewrites the whole
+// file, up to store.maxActivities activities, and instances don't see each
+// other's writes. Lookups aren't held up by the write, which happens outside the
+// store's lock.
+type FileActivityStore struct {
+	*MemoryActivityStore
+	path    string
+	version uint64 // Changes made, guarded by mu
+
+	writeMu sync.Mutex
+	written uint64 // Version of the file on disk, guarded by writeMu
+}
+
+// NewFileActivityStore opens the store at path, loading any activities already saved there
+func NewFileActivityStore(path string, maxActivities int) (*FileActivityStore, error) {
+	s := &FileActivityStore{
+		MemoryActivityStore: NewMemoryActivityStore(maxActivities),
+		path:                path,
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read activity store: %w", err)
+	}
+
+	var activities []Activity
+	if err := json.Unmarshal(data, &activities); err != nil {
+		return nil, fmt.Errorf("failed to parse activity store %s: %w", path, err)
+	}
+	s.put(activities)
+	return s, nil
+}
+
+// Put implements ActivityStore
+func (s *FileActivityStore) Put(ctx context.Context, activities []Activity) error {
+	s.mu.Lock()
+	s.put(activities)
+	s.version++
+	version, snapshot := s.version, s.snapshot()
+	s.mu.Unlock()
+
+	return s.save(version, snapshot)
+}
+
+// save writes a snapshot of the store to its file, unless a later one has
+// already been written by a concurrent Put
+func (s *FileActivityStore) save(version uint64, snapshot []Activity) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode activity store: %w", err)
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if version <= s.written {
+		return nil
+	}
+	if err := writeFileAtomic(s.path, data); err != nil {
+		return fmt.Errorf("failed to write activity store: %w", err)
+	}
+	s.written = version
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path,
+// so a crash never leaves a half-written file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,98 @@
+package schoolsout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestMemoryActivityStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryActivityStore(2)
+
+	if err := store.Put(ctx, []Activity{{ID: "a", Title: "Zoo"}, {ID: "b", Title: "Museum"}, {Title: "No ID"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, []Activity{{ID: "a", Title: "Zoo day"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Get(ctx, "a"); err != nil || got.Title != "Zoo day" {
+		t.Errorf("Get(a) = %+v, %v; want the replaced activity", got, err)
+	}
+
+	// Replacing an activity doesn't make it newer, so "a" is evicted first
+	if err := store.Put(ctx, []Activity{{ID: "c", Title: "Pool"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "a"); !errors.Is(err, ErrActivityNotFound) {
+		t.Errorf("Get(a) error = %v, want ErrActivityNotFound after eviction", err)
+	}
+	for _, id := range []string{"b", "c"} {
+		if _, err := store.Get(ctx, id); err != nil {
+			t.Errorf("Get(%s) error = %v", id, err)
+		}
+	}
+	if _, err := store.Get(ctx, ""); !errors.Is(err, ErrActivityNotFound) {
+		t.Errorf("Get of an empty ID error = %v, want ErrActivityNotFound", err)
+	}
+}
+
+func TestFileActivityStoreReloads(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "activities.json")
+
+	store, err := NewFileActivityStore(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, []Activity{{ID: "a"}, {ID: "b"}, {ID: "c", Title: "Pool"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewFileActivityStore(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reopened.Get(ctx, "c"); err != nil || got.Title != "Pool" {
+		t.Errorf("Get(c) after reopening = %+v, %v", got, err)
+	}
+	if _, err := reopened.Get(ctx, "a"); !errors.Is(err, ErrActivityNotFound) {
+		t.Errorf("Get(a) after reopening error = %v, want ErrActivityNotFound", err)
+	}
+}
+
+func TestFileActivityStoreConcurrentPuts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "activities.json")
+	store, err := NewFileActivityStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const puts = 20
+	var wg sync.WaitGroup
+	for i := range puts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := store.Put(ctx, []Activity{{ID: fmt.Sprint(i)}}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Whichever write landed last, the file holds every activity
+	reopened, err := NewFileActivityStore(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range puts {
+		if _, err := reopened.Get(ctx, fmt.Sprint(i)); err != nil {
+			t.Errorf("Get(%d) after reopening error = %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package schoolsout
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Supported trace exporters
+const (
+	tracingExporterNone   = "none"
+	tracingExporterStdout = "stdout"
+	tracingExporterOTLP   = "otlp" // configured with the standard OTEL_EXPORTER_OTLP_* variables
+)
+
+// cloudTraceHeader is the Google Cloud trace propagation header
+const cloudTraceHeader = "X-Cloud-Trace-Context"
+
+// tracingShutdownTimeout bounds exporting buffered spans when the instance stops
+const tracingShutdownTimeout = 5 * time.Second
+
+var (
+	tracerProvider = newTracerProvider(appConfig)
+	tracer         = tracerProvider.Tracer(instrumentationName)
+
+	// tracePropagator continues an incoming traceparent or X-Cloud-Trace-Context
+	tracePropagator = propagation.NewCompositeTextMapPropagator(
+		cloudTracePropagator{},
+		propagation.TraceContext{},
+	)
+)
+
+// newTracerProvider creates the tracer provider for the configured exporter.
+// Misconfiguration falls back to a no-op provider so tracing never breaks searches.
+func newTracerProvider(cfg *Config) trace.TracerProvider {
+	var exporter sdktrace.SpanExporter
+
+	switch cfg.Tracing.Exporter {
+	case tracingExporterStdout:
+		stdoutExporter, err := stdouttrace.New()
+		if err != nil {
+			logger.Error("Failed to create stdout trace exporter", "error", err)
+			return noop.NewTracerProvider()
+		}
+		exporter = stdoutExporter
+	case tracingExporterOTLP:
+		otlpExporter, err := otlptracehttp.New(context.Background())
+		if err != nil {
+			logger.Error("Failed to create OTLP trace exporter", "error", err)
+			return noop.NewTracerProvider()
+		}
+		exporter = otlpExporter
+	default:
+		return noop.NewTracerProvider()
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.Tracing.SampleRatio))),
+	)
+}
+
+// init flushes buffered spans when the platform stops the instance, then lets
+// the signal stop the process as it would have without this handler.
+//
+// It has to be an init handler: the functions framework's Start only calls
+// http.ListenAndServe, with no shutdown hook, and the buildpack generates the
+// main package that calls it. Re-raising the signal leaves the framework's own
+// handling of SIGTERM as it was, after a flush bounded by tracingShutdownTimeout.
+func init() {
+	if _, ok := tracerProvider.(*sdktrace.TracerProvider); !ok {
+		return
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		sig := <-stop
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("Failed to flush traces on shutdown", "error", err)
+		}
+		cancel()
+
+		signal.Reset(sig)
+		if process, err := os.FindProcess(os.Getpid()); err != nil || process.Signal(sig) != nil {
+			os.Exit(1)
+		}
+	}()
+}
+
+// shutdownTracing exports buffered spans and stops the tracer provider
+func shutdownTracing(ctx context.Context) error {
+	provider, ok := tracerProvider.(*sdktrace.TracerProvider)
+	if !ok {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
+
+// validTracingExporter reports whether name is a supported trace exporter
+func validTracingExporter(name string) error {
+	switch name {
+	case tracingExporterNone, tracingExporterStdout, tracingExporterOTLP:
+		return nil
+	}
+	return fmt.Errorf("tracing.exporter must be one of none, stdout or otlp")
+}
+
+// withTracing starts a server span for each request, continuing any incoming trace
+func withTracing(name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracePropagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("user_agent.original", r.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r.WithContext(ctx))
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+// endSpan records err on the span (if any) and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// cloudTracePropagator reads and writes the X-Cloud-Trace-Context header
+// (TRACE_ID/SPAN_ID;o=OPTIONS, where SPAN_ID is decimal)
+type cloudTracePropagator struct{}
+
+// Inject implements propagation.TextMapPropagator
+func (cloudTracePropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	spanID := sc.SpanID()
+	options := 0
+	if sc.IsSampled() {
+		options = 1
+	}
+	carrier.Set(cloudTraceHeader, fmt.Sprintf("%s/%d;o=%d", sc.TraceID(), binary.BigEndian.Uint64(spanID[:]), options))
+}
+
+// Extract implements propagation.TextMapPropagator
+func (cloudTracePropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	header := carrier.Get(cloudTraceHeader)
+	if header == "" {
+		return ctx
+	}
+
+	traceIDText, rest, _ := strings.Cut(header, "/")
+	spanIDText, options, _ := strings.Cut(rest, ";")
+
+	traceIDBytes, err := hex.DecodeString(traceIDText)
+	if err != nil || len(traceIDBytes) != 16 {
+		return ctx
+	}
+	spanIDValue, err := strconv.ParseUint(spanIDText, 10, 64)
+	if err != nil {
+		return ctx
+	}
+
+	var traceID trace.TraceID
+	var spanID trace.SpanID
+	copy(traceID[:], traceIDBytes)
+	binary.BigEndian.PutUint64(spanID[:], spanIDValue)
+
+	var flags trace.TraceFlags
+	if options == "o=1" {
+		flags = trace.FlagsSampled
+	}
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: flags,
+		Remote:     true,
+	})
+	if !sc.IsValid() {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Fields implements propagation.TextMapPropagator
+func (cloudTracePropagator) Fields() []string {
+	return []string{cloudTraceHeader}
+}
@@ -0,0 +1,135 @@
+package schoolsout
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// useSpanRecorder sends every span to a recorder for the rest of the test
+func useSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := tracer
+	tracer = provider.Tracer(instrumentationName)
+	t.Cleanup(func() { tracer = previous })
+	return recorder
+}
+
+// endedSpan returns the ended span with a name, failing the test without one
+func endedSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	t.Fatalf("no %q span", name)
+	return nil
+}
+
+// spanAttribute returns the value of a span attribute, or an empty value
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestHandlerSpanContinuesIncomingTrace(t *testing.T) {
+	recorder := useSpanRecorder(t)
+	req := httptest.NewRequest(http.MethodGet, "/v1/categories", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	span := endedSpan(t, recorder, "GET /v1/categories")
+	if span.SpanKind() != trace.SpanKindServer {
+		t.Errorf("kind = %v, want server", span.SpanKind())
+	}
+	if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID = %s, want the incoming one", got)
+	}
+	if got := span.Parent().SpanID().String(); got != "00f067aa0ba902b7" || !span.Parent().IsRemote() {
+		t.Errorf("parent = %s, want the incoming remote span", got)
+	}
+	if got := spanAttribute(span, "http.response.status_code").AsInt64(); got != http.StatusOK {
+		t.Errorf("status code attribute = %d, want 200", got)
+	}
+}
+
+func TestGeminiStageSpans(t *testing.T) {
+	recorder := useSpanRecorder(t)
+	useFakeGemini(t, Activity{Title: "Zoo day", Category: "outdoor", BookingURL: "https://zoo.example.com/day"})
+
+	req := &SearchRequest{Query: "zoo"}
+	if _, err := NewGeminiClient(context.Background()).GenerateActivitiesSuggestions(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	search := endedSpan(t, recorder, "searchWithGoogleSearch")
+	convert := endedSpan(t, recorder, "convertToStructuredJSON")
+	var calls []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "sendGeminiRequest" {
+			calls = append(calls, span)
+		}
+	}
+	if len(calls) != 2 {
+		t.Fatalf("%d sendGeminiRequest spans, want one per stage", len(calls))
+	}
+	parents := map[trace.SpanID]bool{search.SpanContext().SpanID(): false, convert.SpanContext().SpanID(): false}
+	for _, call := range calls {
+		if _, ok := parents[call.Parent().SpanID()]; !ok {
+			t.Errorf("sendGeminiRequest span is not a child of a stage span")
+		}
+		parents[call.Parent().SpanID()] = true
+		if call.SpanKind() != trace.SpanKindClient {
+			t.Errorf("sendGeminiRequest kind = %v, want client", call.SpanKind())
+		}
+	}
+	if got := spanAttribute(calls[0], "gemini.google_search").AsBool(); !got {
+		t.Error("the first Gemini call is not marked as a Google Search call")
+	}
+}
+
+func TestCloudTracePropagatorRoundTrip(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("105445aa7843bc8bf206b12000100000")
+	spanID, _ := trace.SpanIDFromHex("0000000000000001")
+	for _, flags := range []trace.TraceFlags{0, trace.FlagsSampled} {
+		sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: flags})
+		carrier := propagation.HeaderCarrier(http.Header{})
+		cloudTracePropagator{}.Inject(trace.ContextWithSpanContext(context.Background(), sc), carrier)
+
+		want := "105445aa7843bc8bf206b12000100000/1;o=0"
+		if flags.IsSampled() {
+			want = "105445aa7843bc8bf206b12000100000/1;o=1"
+		}
+		if got := carrier.Get(cloudTraceHeader); got != want {
+			t.Errorf("header = %q, want %q", got, want)
+		}
+
+		got := trace.SpanContextFromContext(cloudTracePropagator{}.Extract(context.Background(), carrier))
+		if got.TraceID() != traceID || got.SpanID() != spanID || got.IsSampled() != flags.IsSampled() || !got.IsRemote() {
+			t.Errorf("extracted %+v, want trace %s span %s sampled %v", got, traceID, spanID, flags.IsSampled())
+		}
+	}
+}
+
+func TestCloudTracePropagatorIgnoresBadHeaders(t *testing.T) {
+	for _, header := range []string{"", "nothex/1;o=1", "105445aa7843bc8bf206b12000100000/span;o=1", "00000000000000000000000000000000/1;o=1", "105445aa/1;o=1"} {
+		carrier := propagation.HeaderCarrier(http.Header{cloudTraceHeader: {header}})
+		if sc := trace.SpanContextFromContext(cloudTracePropagator{}.Extract(context.Background(), carrier)); sc.IsValid() {
+			t.Errorf("Extract(%q) = %+v, want no span context", header, sc)
+		}
+	}
+}
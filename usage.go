@@ -0,0 +1,159 @@
+package schoolsout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Actions taken when a token budget is exceeded during a search. Either way, new
+// searches are refused once the daily budget is used up.
+const (
+	budgetActionAbort   = "abort"   // Fail the search before any further Gemini call
+	budgetActionDegrade = "degrade" // Finish the essential stages but skip Stage 3 URL recovery
+)
+
+// ErrTokenBudgetExceeded is returned when a search or the daily token budget is used up
+var ErrTokenBudgetExceeded = errors.New("token budget exceeded")
+
+// UsageMetadata represents token counts reported by Gemini for a single call
+type UsageMetadata struct {
+	PromptTokenCount        int `json:"promptTokenCount,omitempty"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount,omitempty"`
+	ToolUsePromptTokenCount int `json:"toolUsePromptTokenCount,omitempty"`
+	TotalTokenCount         int `json:"totalTokenCount,omitempty"`
+}
+
+// TokenUsage represents the tokens used and estimated cost of a search
+type TokenUsage struct {
+	Calls               int     `json:"calls"`
+	PromptTokens        int     `json:"promptTokens"`
+	CandidatesTokens    int     `json:"candidatesTokens"`
+	ToolUsePromptTokens int     `json:"toolUsePromptTokens"`
+	TotalTokens         int     `json:"totalTokens"`
+	EstimatedCostUSD    float64 `json:"estimatedCostUsd"`
+}
+
+// add accumulates the counts from one Gemini call
+func (u *TokenUsage) add(m UsageMetadata, cfg GeminiConfig) {
+	u.Calls++
+	u.PromptTokens += m.PromptTokenCount
+	u.CandidatesTokens += m.CandidatesTokenCount
+	u.ToolUsePromptTokens += m.ToolUsePromptTokenCount
+	u.TotalTokens += m.TotalTokenCount
+
+	// Tool-use prompt tokens are billed as input
+	inputTokens := float64(m.PromptTokenCount + m.ToolUsePromptTokenCount)
+	outputTokens := float64(m.CandidatesTokenCount)
+	u.EstimatedCostUSD += (inputTokens*cfg.InputPricePerMillion + outputTokens*cfg.OutputPricePerMillion) / 1e6
+}
+
+// usageTracker aggregates token usage across all stages of one search
+type usageTracker struct {
+	mu    sync.Mutex
+	usage TokenUsage
+}
+
+// usageTrackerKey is the context key for usageTracker
+type usageTrackerKey struct{}
+
+// withUsageTracker returns a context that accumulates token usage for a search
+func withUsageTracker(ctx context.Context) context.Context {
+	return context.WithValue(ctx, usageTrackerKey{}, &usageTracker{})
+}
+
+// usageFromContext returns the token usage accumulated so far for the search in ctx
+func usageFromContext(ctx context.Context) TokenUsage {
+	tracker, ok := ctx.Value(usageTrackerKey{}).(*usageTracker)
+	if !ok {
+		return TokenUsage{}
+	}
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	return tracker.usage
+}
+
+// recordTokenUsage adds the usage of one Gemini call to the search, the daily total and metrics
+func recordTokenUsage(ctx context.Context, m UsageMetadata) {
+	if tracker, ok := ctx.Value(usageTrackerKey{}).(*usageTracker); ok {
+		tracker.mu.Lock()
+		tracker.usage.add(m, appConfig.Gemini)
+		tracker.mu.Unlock()
+	}
+	dailyUsage.add(m.TotalTokenCount)
+	metrics.recordTokens(ctx, m)
+}
+
+// dailyTokenUsage counts tokens used by this instance since midnight UTC
+type dailyTokenUsage struct {
+	mu    sync.Mutex
+	day   string
+	total int
+}
+
+// dailyUsage is the per-instance daily token counter
+var dailyUsage = &dailyTokenUsage{}
+
+// add counts tokens against today's total
+func (d *dailyTokenUsage) add(tokens int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rollover()
+	d.total += tokens
+}
+
+// used returns the tokens used today
+func (d *dailyTokenUsage) used() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rollover()
+	return d.total
+}
+
+// rollover resets the counter when the UTC day changes. Caller must hold d.mu.
+func (d *dailyTokenUsage) rollover() {
+	today := time.Now().UTC().Format("2006-01-02")
+	if d.day != today {
+		d.day = today
+		d.total = 0
+	}
+}
+
+// tokenBudgetError returns ErrTokenBudgetExceeded if the search in ctx or this
+// instance's daily usage has reached its configured budget
+func tokenBudgetError(ctx context.Context) error {
+	budget := appConfig.Budget
+
+	if err := dailyBudgetError(); err != nil {
+		return err
+	}
+	if budget.MaxTokensPerRequest > 0 {
+		if used := usageFromContext(ctx).TotalTokens; used >= budget.MaxTokensPerRequest {
+			return fmt.Errorf("%w: %d of %d tokens used by this search", ErrTokenBudgetExceeded, used, budget.MaxTokensPerRequest)
+		}
+	}
+	return nil
+}
+
+// dailyBudgetError returns ErrTokenBudgetExceeded if this instance's daily usage
+// has reached its configured budget. New searches check it whatever the budget action.
+func dailyBudgetError() error {
+	budget := appConfig.Budget
+	if budget.MaxTokensPerDay > 0 {
+		if used := dailyUsage.used(); used >= budget.MaxTokensPerDay {
+			return fmt.Errorf("%w: %d of %d daily tokens used", ErrTokenBudgetExceeded, used, budget.MaxTokensPerDay)
+		}
+	}
+	return nil
+}
+
+// validBudgetAction reports whether name is a supported budget action
+func validBudgetAction(name string) error {
+	switch name {
+	case budgetActionAbort, budgetActionDegrade:
+		return nil
+	}
+	return fmt.Errorf("budget.action must be abort or degrade")
+}
@@ -0,0 +1,110 @@
+package schoolsout
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// useBudget sets the token budget and starts today's usage from zero for the rest of the test
+func useBudget(t *testing.T, budget BudgetConfig) {
+	t.Helper()
+	previousBudget, previousUsage := appConfig.Budget, dailyUsage
+	appConfig.Budget, dailyUsage = budget, &dailyTokenUsage{}
+	t.Cleanup(func() { appConfig.Budget, dailyUsage = previousBudget, previousUsage })
+}
+
+func TestTokenUsageAdd(t *testing.T) {
+	cfg := GeminiConfig{InputPricePerMillion: 1, OutputPricePerMillion: 4}
+	var usage TokenUsage
+	usage.add(UsageMetadata{PromptTokenCount: 1000, ToolUsePromptTokenCount: 500, CandidatesTokenCount: 250, TotalTokenCount: 1750}, cfg)
+	usage.add(UsageMetadata{PromptTokenCount: 500, CandidatesTokenCount: 500, TotalTokenCount: 1000}, cfg)
+
+	if usage.Calls != 2 || usage.PromptTokens != 1500 || usage.ToolUsePromptTokens != 500 ||
+		usage.CandidatesTokens != 750 || usage.TotalTokens != 2750 {
+		t.Errorf("usage = %+v", usage)
+	}
+	// 2000 input tokens at $1 and 750 output tokens at $4 per million
+	if want := 0.005; math.Abs(usage.EstimatedCostUSD-want) > 1e-12 {
+		t.Errorf("EstimatedCostUSD = %v, want %v", usage.EstimatedCostUSD, want)
+	}
+}
+
+func TestRecordTokenUsage(t *testing.T) {
+	useBudget(t, BudgetConfig{Action: budgetActionAbort})
+	ctx := withUsageTracker(context.Background())
+	recordTokenUsage(ctx, UsageMetadata{TotalTokenCount: 100})
+	recordTokenUsage(context.Background(), UsageMetadata{TotalTokenCount: 50})
+
+	if got := usageFromContext(ctx).TotalTokens; got != 100 {
+		t.Errorf("search used %d tokens, want 100", got)
+	}
+	if got := dailyUsage.used(); got != 150 {
+		t.Errorf("day used %d tokens, want 150", got)
+	}
+}
+
+func TestDailyTokenUsageRollsOver(t *testing.T) {
+	usage := &dailyTokenUsage{day: "2000-01-01", total: 1000}
+	usage.add(10)
+	if got := usage.used(); got != 10 {
+		t.Errorf("used = %d after the day changed, want 10", got)
+	}
+}
+
+func TestTokenBudgetError(t *testing.T) {
+	tests := []struct {
+		name         string
+		budget       BudgetConfig
+		dayTokens    int
+		searchTokens int
+		wantSearch   bool // tokenBudgetError fails
+		wantDaily    bool // dailyBudgetError fails
+	}{
+		{"no budget", BudgetConfig{}, 1e6, 1e6, false, false},
+		{"under both", BudgetConfig{MaxTokensPerRequest: 100, MaxTokensPerDay: 1000}, 500, 50, false, false},
+		{"search used up", BudgetConfig{MaxTokensPerRequest: 100, MaxTokensPerDay: 1000}, 500, 100, true, false},
+		{"day used up", BudgetConfig{MaxTokensPerRequest: 100, MaxTokensPerDay: 1000}, 1000, 0, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useBudget(t, tt.budget)
+			dailyUsage.add(tt.dayTokens - tt.searchTokens)
+			ctx := withUsageTracker(context.Background())
+			recordTokenUsage(ctx, UsageMetadata{TotalTokenCount: tt.searchTokens})
+
+			if err := tokenBudgetError(ctx); (err != nil) != tt.wantSearch || (err != nil && !errors.Is(err, ErrTokenBudgetExceeded)) {
+				t.Errorf("tokenBudgetError = %v, want failure %v", err, tt.wantSearch)
+			}
+			if err := dailyBudgetError(); (err != nil) != tt.wantDaily {
+				t.Errorf("dailyBudgetError = %v, want failure %v", err, tt.wantDaily)
+			}
+		})
+	}
+}
+
+func TestDailyBudgetRefusesNewSearches(t *testing.T) {
+	for _, action := range []string{budgetActionAbort, budgetActionDegrade} {
+		t.Run(action, func(t *testing.T) {
+			useBudget(t, BudgetConfig{MaxTokensPerDay: 1000, Action: action})
+			dailyUsage.add(1000)
+			gemini := useFakeGemini(t)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/search?q=zoo", nil))
+
+			var response SearchResponse
+			json.NewDecoder(rec.Body).Decode(&response)
+			if rec.Code != http.StatusServiceUnavailable || response.ErrorCode != errorCodeBudgetExceeded {
+				t.Errorf("status = %d, errorCode %q; want 503 %s", rec.Code, response.ErrorCode, errorCodeBudgetExceeded)
+			}
+			if calls := len(gemini.searchRequests()); calls != 0 {
+				t.Errorf("Gemini was called %d times", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package schoolsout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Weather providers
+const (
+	weatherProviderNone      = "none"
+	weatherProviderOpenMeteo = "openmeteo"
+	weatherProviderFixture   = "fixture"
+)
+
+// openMeteoForecastDays is how far ahead Open-Meteo forecasts, counting today
+const openMeteoForecastDays = 16
+
+// forecastCacheTTL is how long a fetched forecast is reused for the same place and dates
+const forecastCacheTTL = time.Hour
+
+// DailyForecast is the weather forecast for one day at the search location
+type DailyForecast struct {
+	Date            string   `json:"date"` // yyyy-MM-dd
+	MaxTempC        *float64 `json:"maxTempC,omitempty"`
+	MinTempC        *float64 `json:"minTempC,omitempty"`
+	RainChance      *int     `json:"rainChance,omitempty"` // Percent
+	PrecipitationMm *float64 `json:"precipitationMm,omitempty"`
+	Advisory        string   `json:"advisory,omitempty"` // Set on days that are too wet or too hot for outdoor plans
+}
+
+// WeatherProvider forecasts the weather at a place
+type WeatherProvider interface {
+	// Forecast returns the days of dateRange it has a forecast for, which may be none
+	Forecast(ctx context.Context, place Place, dateRange DateRange) ([]DailyForecast, error)
+}
+
+// weather forecasts the weather for searches; nil when no provider is configured
+var weather = newWeatherProvider(appConfig.Weather)
+
+// newWeatherProvider returns the provider selected by weather.provider
+func newWeatherProvider(cfg WeatherConfig) WeatherProvider {
+	switch cfg.Provider {
+	case weatherProviderOpenMeteo:
+		return &OpenMeteoProvider{
+			BaseURL: cfg.BaseURL,
+			Client:  &http.Client{Timeout: time.Duration(cfg.Timeout)},
+			cache:   make(map[string]cachedForecast),
+		}
+	case weatherProviderFixture:
+		provider, err := NewFixtureWeatherProvider(cfg.FixtureFile)
+		if err != nil {
+			logger.Error("Failed to load weather fixture, weather disabled", "file", cfg.FixtureFile, "error", err)
+			return nil
+		}
+		return provider
+	default:
+		return nil
+	}
+}
+
+// validWeatherProvider reports whether name is a supported weather provider
+func validWeatherProvider(name string) error {
+	switch name {
+	case weatherProviderNone, weatherProviderOpenMeteo, weatherProviderFixture:
+		return nil
+	}
+	return fmt.Errorf("weather.provider must be none, openmeteo or fixture")
+}
+
+// OpenMeteoProvider forecasts with the Open-Meteo API, which needs no API key
+type OpenMeteoProvider struct {
+	BaseURL string
+	Client  *http.Client
+
+	mu    sync.Mutex
+	cache map[string]cachedForecast
+}
+
+// cachedForecast is a forecast kept by OpenMeteoProvider
+type cachedForecast struct {
+	days    []DailyForecast
+	expires time.Time
+}
+
+// openMeteoResponse is the part of an Open-Meteo forecast response that is used
+type openMeteoResponse struct {
+	Daily struct {
+		Time             []string   `json:"time"`
+		TemperatureMax   []*float64 `json:"temperature_2m_max"`
+		TemperatureMin   []*float64 `json:"temperature_2m_min"`
+		PrecipitationSum []*float64 `json:"precipitation_sum"`
+		RainChanceMax    []*float64 `json:"precipitation_probability_max"`
+	} `json:"daily"`
+}
+
+// Forecast implements WeatherProvider. Days beyond Open-Meteo's forecast horizon are left out.
+func (p *OpenMeteoProvider) Forecast(ctx context.Context, place Place, dateRange DateRange) (days []DailyForecast, err error) {
+	ctx, span := tracer.Start(ctx, "weatherForecast",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("weather.provider", weatherProviderOpenMeteo)),
+	)
+	defer func() { endSpan(span, err) }()
+
+	today := time.Now().Format("2006-01-02")
+	horizon := time.Now().AddDate(0, 0, openMeteoForecastDays-1).Format("2006-01-02")
+	start, end := max(dateRange.StartDate, today), min(dateRange.EndDate, horizon)
+	if start > end {
+		return nil, nil // Nothing forecast yet
+	}
+
+	key := fmt.Sprintf("%.2f,%.2f,%s,%s", place.Latitude, place.Longitude, start, end)
+	p.mu.Lock()
+	cached, ok := p.cache[key]
+	p.mu.Unlock()
+	hit := ok && time.Now().Before(cached.expires)
+	metrics.recordCacheLookup(ctx, "forecast", hit)
+	if hit {
+		// Callers annotate the days they get, so they never get the cache's own
+		return slices.Clone(cached.days), nil
+	}
+
+	query := url.Values{}
+	query.Set("latitude", strconv.FormatFloat(place.Latitude, 'f', 4, 64))
+	query.Set("longitude", strconv.FormatFloat(place.Longitude, 'f', 4, 64))
+	query.Set("daily", "temperature_2m_max,temperature_2m_min,precipitation_sum,precipitation_probability_max")
+	query.Set("timezone", "auto")
+	query.Set("start_date", start)
+	query.Set("end_date", end)
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, p.BaseURL+"/forecast?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create forecast request: %w", err)
+	}
+	resp, err := p.Client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch forecast: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read forecast: %w", err)
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("forecast API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var forecast openMeteoResponse
+	if err := json.Unmarshal(body, &forecast); err != nil {
+		return nil, fmt.Errorf("failed to parse forecast: %w", err)
+	}
+	for i, date := range forecast.Daily.Time {
+		day := DailyForecast{
+			Date:            date,
+			MaxTempC:        valueAt(forecast.Daily.TemperatureMax, i),
+			MinTempC:        valueAt(forecast.Daily.TemperatureMin, i),
+			PrecipitationMm: valueAt(forecast.Daily.PrecipitationSum, i),
+		}
+		if chance := valueAt(forecast.Daily.RainChanceMax, i); chance != nil {
+			percent := int(*chance)
+			day.RainChance = &percent
+		}
+		days = append(days, day)
+	}
+
+	p.mu.Lock()
+	for k, c := range p.cache {
+		if time.Now().After(c.expires) {
+			delete(p.cache, k)
+		}
+	}
+	p.cache[key] = cachedForecast{days: slices.Clone(days), expires: time.Now().Add(forecastCacheTTL)}
+	p.mu.Unlock()
+
+	return days, nil
+}
+
+// valueAt returns values[i], or nil when the response has no value for that day
+func valueAt(values []*float64, i int) *float64 {
+	if i >= len(values) {
+		return nil
+	}
+	return values[i]
+}
+
+// FixtureWeatherProvider returns a fixed forecast read from a JSON file, for local
+// runs and tests. The same days are returned for every place.
+type FixtureWeatherProvider struct {
+	Days []DailyForecast `json:"days"`
+}
+
+// NewFixtureWeatherProvider loads a forecast file of the form {"days": [DailyForecast...]}
+func NewFixtureWeatherProvider(path string) (*FixtureWeatherProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var provider FixtureWeatherProvider
+	if err := json.Unmarshal(data, &provider); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &provider, nil
+}
+
+// Forecast implements WeatherProvider
+func (p *FixtureWeatherProvider) Forecast(ctx context.Context, place Place, dateRange DateRange) ([]DailyForecast, error) {
+	var days []DailyForecast
+	for _, day := range p.Days {
+		if day.Date >= dateRange.StartDate && day.Date <= dateRange.EndDate {
+			days = append(days, day)
+		}
+	}
+	return days, nil
+}
+
+// weatherAdvisory describes why a day is bad for outdoor plans, or "" for a fine day
+func (d DailyForecast) weatherAdvisory() string {
+	cfg := appConfig.Weather
+	switch {
+	case d.RainChance != nil && *d.RainChance >= cfg.RainChance:
+		return fmt.Sprintf("Rain likely (%d%% chance)", *d.RainChance)
+	case d.PrecipitationMm != nil && cfg.RainMm > 0 && *d.PrecipitationMm >= cfg.RainMm:
+		return fmt.Sprintf("Rain forecast (%gmm)", *d.PrecipitationMm)
+	case d.MaxTempC != nil && *d.MaxTempC >= cfg.HotTempC:
+		return fmt.Sprintf("Hot day forecast (%.0f°C)", *d.MaxTempC)
+	}
+	return ""
+}
+
+// resolveForecast fetches the forecast for the search place and dates. Searches
+// without a geocoded place or dates, and failed forecasts, go without.
+func (req *SearchRequest) resolveForecast(ctx context.Context) {
+	if weather == nil || req.place == nil || req.DateRange == nil || req.forecast != nil {
+		return
+	}
+
+	days, err := weather.Forecast(ctx, *req.place, *req.DateRange)
+	if err != nil {
+		logger.WarnContext(ctx, "Weather forecast unavailable", "error", err)
+		return
+	}
+	for i := range days {
+		days[i].Advisory = days[i].weatherAdvisory()
+	}
+	req.forecast = days
+}
+
+// badWeatherDays returns the forecast days an activity may happen on, and how
+// many of them are bad for outdoor plans. A dated activity only looks at its day.
+func badWeatherDays(activity Activity, forecast []DailyForecast) (days []DailyForecast, bad int) {
+	for _, day := range forecast {
+		if activity.Date != "" && activity.Date != day.Date {
+			continue
+		}
+		days = append(days, day)
+		if day.Advisory != "" {
+			bad++
+		}
+	}
+	return days, bad
+}
+
+// applyWeather adds a weather advisory to outdoor activities planned for bad weather
+func applyWeather(activities []Activity, req *SearchRequest) {
+	if len(req.forecast) == 0 {
+		return
+	}
+
+	for i, activity := range activities {
+		if activity.Setting != settingOutdoor && activity.Setting != settingBoth {
+			continue
+		}
+		days, bad := badWeatherDays(activity, req.forecast)
+		switch {
+		case bad == 0:
+		case len(days) == 1:
+			activities[i].WeatherAdvisory = fmt.Sprintf("%s on %s; consider an indoor alternative", days[0].Advisory, days[0].Date)
+		default:
+			activities[i].WeatherAdvisory = fmt.Sprintf("Bad weather forecast on %d of %d days; check the forecast before going", bad, len(days))
+		}
+	}
+}
+
+// weatherScore favours indoor activities when the forecast is bad and is neutral
+// on fine days. Without a forecast it is unknown.
+func weatherScore(activity Activity, req *SearchRequest) float64 {
+	days, bad := badWeatherDays(activity, req.forecast)
+	if len(days) == 0 {
+		return unknownScore
+	}
+	badShare := float64(bad) / float64(len(days))
+	switch activity.Setting {
+	case settingIndoor:
+		return roundScore(unknownScore + 0.5*badShare)
+	case settingOutdoor:
+		return roundScore(unknownScore - 0.5*badShare)
+	}
+	return unknownScore
+}
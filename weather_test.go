@@ -0,0 +1,109 @@
+package schoolsout
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useWeatherProvider swaps the weather provider for the length of a test
+func useWeatherProvider(t *testing.T, provider WeatherProvider) {
+	t.Helper()
+	previous := weather
+	weather = provider
+	t.Cleanup(func() { weather = previous })
+}
+
+func TestWeatherAdvisoriesFromFixture(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "forecast.json")
+	fixture := `{"days": [
+		{"date": "2027-07-05", "maxTempC": 18, "rainChance": 90},
+		{"date": "2027-07-06", "maxTempC": 20, "rainChance": 10},
+		{"date": "2027-07-07", "maxTempC": 38, "rainChance": 0},
+		{"date": "2027-07-20", "maxTempC": 17, "rainChance": 95}
+	]}`
+	if err := os.WriteFile(path, []byte(fixture), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := NewFixtureWeatherProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	useWeatherProvider(t, provider)
+
+	req := SearchRequest{
+		place:     &Place{Name: "Perth", State: "WA", Latitude: -31.95, Longitude: 115.86},
+		DateRange: &DateRange{StartDate: "2027-07-05", EndDate: "2027-07-10"},
+	}
+	req.resolveForecast(context.Background())
+	if len(req.forecast) != 3 {
+		t.Fatalf("forecast has %d days, want the 3 in the date range", len(req.forecast))
+	}
+	for i, want := range []string{"Rain likely (90% chance)", "", "Hot day forecast (38°C)"} {
+		if got := req.forecast[i].Advisory; got != want {
+			t.Errorf("%s advisory = %q, want %q", req.forecast[i].Date, got, want)
+		}
+	}
+
+	activities := []Activity{
+		{Title: "Beach day", Setting: settingOutdoor, Date: "2027-07-05"},
+		{Title: "Bush walk", Setting: settingOutdoor, Date: "2027-07-06"},
+		{Title: "Playground", Setting: settingBoth},
+		{Title: "Museum", Setting: settingIndoor, Date: "2027-07-05"},
+	}
+	applyWeather(activities, &req)
+	want := []string{
+		"Rain likely (90% chance) on 2027-07-05; consider an indoor alternative",
+		"",
+		"Bad weather forecast on 2 of 3 days; check the forecast before going",
+		"",
+	}
+	for i, activity := range activities {
+		if activity.WeatherAdvisory != want[i] {
+			t.Errorf("%s advisory = %q, want %q", activity.Title, activity.WeatherAdvisory, want[i])
+		}
+	}
+
+	if score := weatherScore(activities[3], &req); score <= unknownScore {
+		t.Errorf("indoor activity on a wet day scored %g, want above %g", score, unknownScore)
+	}
+	if score := weatherScore(activities[0], &req); score >= unknownScore {
+		t.Errorf("outdoor activity on a wet day scored %g, want below %g", score, unknownScore)
+	}
+}
+
+func TestOpenMeteoCacheIsNotShared(t *testing.T) {
+	today := time.Now().Format("2006-01-02")
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprintf(w, `{"daily":{"time":[%q],"temperature_2m_max":[20],"temperature_2m_min":[10],"precipitation_sum":[0],"precipitation_probability_max":[80]}}`, today)
+	}))
+	defer server.Close()
+
+	provider := newWeatherProvider(WeatherConfig{Provider: weatherProviderOpenMeteo, BaseURL: server.URL, Timeout: Duration(time.Second)})
+	useWeatherProvider(t, provider)
+	dates := &DateRange{StartDate: today, EndDate: today}
+
+	first := SearchRequest{place: &Place{Latitude: -31.95, Longitude: 115.86}, DateRange: dates}
+	first.resolveForecast(context.Background())
+	second := SearchRequest{place: &Place{Latitude: -31.95, Longitude: 115.86}, DateRange: dates}
+	second.resolveForecast(context.Background())
+
+	if calls != 1 {
+		t.Errorf("forecast API called %d times, want 1", calls)
+	}
+	if len(first.forecast) != 1 || len(second.forecast) != 1 {
+		t.Fatalf("forecasts have %d and %d days, want 1", len(first.forecast), len(second.forecast))
+	}
+	first.forecast[0].Advisory = "changed"
+	if !strings.HasPrefix(second.forecast[0].Advisory, "Rain likely") {
+		t.Errorf("second search's advisory = %q; it shares the first search's days", second.forecast[0].Advisory)
+	}
+}